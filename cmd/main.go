@@ -56,18 +56,18 @@ func main() {
 	if *useApi {
 		// APIモードで実行
 		fmt.Printf("APIサーバーモードで起動します (ポート: %d)...\n", *port)
-		runApiServer(cfg, *port)
+		runApiServer(cfg, cfgPath, *port)
 	} else {
 		// CLIモードで実行
 		fmt.Println("CLIモードで起動します...")
-		runCLI(cfg)
+		runCLI(cfg, cfgPath)
 	}
 }
 
 // APIサーバーモードでの実行
-func runApiServer(cfg *config.Config, port int) {
+func runApiServer(cfg *config.Config, cfgPath string, port int) {
 	// APIサーバーを作成
-	server := api.NewServer(cfg, port)
+	server := api.NewServer(cfg, cfgPath, port)
 
 	// サーバー起動をゴルーチンで行う
 	go func() {
@@ -91,9 +91,13 @@ func runApiServer(cfg *config.Config, port int) {
 }
 
 // CLIモードでの実行
-func runCLI(cfg *config.Config) {
+func runCLI(cfg *config.Config, cfgPath string) {
 	// ジェスチャー認識サービスを作成
-	service := api.NewGestureService(cfg)
+	configDir := ""
+	if cfgPath != "" {
+		configDir = filepath.Dir(cfgPath)
+	}
+	service := api.NewGestureService(cfg, configDir)
 
 	// サービス開始
 	if err := service.Start(); err != nil {
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/char5742/keyball-gestures/internal/config"
+	"github.com/char5742/keyball-gestures/internal/features"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// サービスが作成する仮想デバイスの名前（仮想タッチパッドの名前は設定で変更できる）
+const (
+	wheelMouseName          = "VirtualWheelMouse"
+	tabletName              = "VirtualTablet"
+	precisionMouseName      = "VirtualPrecisionMouse"
+	keyEmitterName          = "VirtualKeyboard"
+	passthroughMouseName    = "VirtualPassthroughMouse"
+	passthroughKeyboardName = "VirtualPassthroughKeyboard"
+)
+
+// backendDevices はバックエンドが専有する仮想デバイスの名前と、そのバックエンドの対応
+var backendDevices = map[string]string{
+	wheelMouseName:     config.BackendWheel,
+	tabletName:         config.BackendTablet,
+	precisionMouseName: config.BackendPrecision,
+}
+
+// backendFactory はジェスチャーの出力バックエンドを作成する関数
+type backendFactory func(s *GestureService) (features.GestureBackend, error)
+
+// backendFactories はバックエンド名と作成関数の対応
+// 新しい出力先はここに登録するだけでジェスチャーループから利用できる
+var backendFactories = map[string]backendFactory{
+	config.BackendTouchPad: func(s *GestureService) (features.GestureBackend, error) {
+		if s.touchPad == nil {
+			return nil, fmt.Errorf("仮想タッチパッドが作成されていません")
+		}
+		return features.NewTouchPadBackend(s.touchPad, s.touchRecorder.Bounds()), nil
+	},
+	config.BackendWheel: func(s *GestureService) (features.GestureBackend, error) {
+		pointer, err := features.CreatePointer(s.cfg.UinputPath(), []byte(wheelMouseName))
+		if err != nil {
+			return nil, fmt.Errorf("仮想マウスの作成に失敗しました: %v", err)
+		}
+		return features.NewWheelBackend(pointer), nil
+	},
+	config.BackendShortcut: func(s *GestureService) (features.GestureBackend, error) {
+		return features.NewShortcutBackend(s.getActionExecutor()), nil
+	},
+	config.BackendKeystroke: func(s *GestureService) (features.GestureBackend, error) {
+		keys, err := s.getKeyEmitter()
+		if err != nil {
+			return nil, err
+		}
+		return features.NewKeystrokeBackend(keys), nil
+	},
+	config.BackendTablet: func(s *GestureService) (features.GestureBackend, error) {
+		tablet, err := features.CreateTablet(s.cfg.UinputPath(), []byte(tabletName))
+		if err != nil {
+			return nil, fmt.Errorf("仮想タブレットの作成に失敗しました: %v", err)
+		}
+		return features.NewTabletBackend(tablet), nil
+	},
+	config.BackendPrecision: func(s *GestureService) (features.GestureBackend, error) {
+		pointer, err := features.CreatePointer(s.cfg.UinputPath(), []byte(precisionMouseName))
+		if err != nil {
+			return nil, fmt.Errorf("仮想マウスの作成に失敗しました: %v", err)
+		}
+		return features.NewPrecisionBackend(pointer), nil
+	},
+	config.BackendStroke: func(s *GestureService) (features.GestureBackend, error) {
+		store, err := s.strokeStore()
+		if err != nil {
+			return nil, err
+		}
+		return features.NewStrokeBackend(s.getActionExecutor(), store), nil
+	},
+	config.BackendReplay: func(s *GestureService) (features.GestureBackend, error) {
+		if s.player == nil {
+			return nil, fmt.Errorf("仮想タッチパッドが作成されていません")
+		}
+		store, err := s.recordingStore()
+		if err != nil {
+			return nil, err
+		}
+		return features.NewReplayBackend(s.player, store), nil
+	},
+}
+
+// gestureFor は既定値を補ったバインディングを、バックエンドに渡すジェスチャーの設定に変換する
+// filter は仮想指を置き直すときにリセットする移動量のフィルター
+func gestureFor(b config.BindingConfig, cfg *config.Config, filter *features.MotionFilter) features.Gesture {
+	anchorX, anchorY := b.AnchorPoint(cfg.TouchPad)
+
+	swipeActions := make(map[features.SwipeDirection]features.SwipeAction)
+	for _, dir := range []features.SwipeDirection{features.SwipeLeft, features.SwipeRight, features.SwipeUp, features.SwipeDown} {
+		d := b.Swipe.Direction(string(dir))
+		swipeActions[dir] = features.SwipeAction{
+			Action: actionFor(d.ActionConfig),
+			Repeat: d.Repeat == config.RepeatRepeat,
+		}
+	}
+	strokeActions := make(map[string]features.Action, len(b.Stroke.Actions))
+	for name, action := range b.Stroke.Actions {
+		strokeActions[name] = actionFor(action)
+	}
+
+	return features.Gesture{
+		Fingers: b.Fingers,
+		Pointer: b.Mode == config.BindingModePointer,
+		Layout: features.FingerLayout{
+			AnchorX:     anchorX,
+			AnchorY:     anchorY,
+			Arrangement: arrangementFor(b.Arrangement),
+			Spacing:     b.FingerSpacing,
+			TouchMajor:  b.TouchMajor,
+			Pressure:    b.Pressure,
+		},
+		ResetThreshold: cfg.Gesture.ResetThreshold,
+		MotionFilter:   filter,
+		Wheel: features.WheelOptions{
+			DetentSize: b.Wheel.DetentSize,
+			Invert:     b.Wheel.Invert,
+		},
+		Swipe: features.SwipeOptions{
+			Distance: b.Swipe.Distance,
+			Velocity: b.Swipe.Velocity,
+			Actions:  swipeActions,
+		},
+		Keystroke: features.KeystrokeOptions{
+			Step:    b.Keystroke.Step,
+			MaxRate: b.Keystroke.MaxRate,
+			Up:      b.Keystroke.Up,
+			Down:    b.Keystroke.Down,
+			Left:    b.Keystroke.Left,
+			Right:   b.Keystroke.Right,
+		},
+		Stroke: features.StrokeOptions{
+			Threshold:   b.Stroke.Threshold,
+			MinDistance: b.Stroke.MinDistance,
+			Actions:     strokeActions,
+		},
+		TabletGain:     b.Tablet.Gain,
+		PrecisionScale: b.Precision.Scale,
+		Replay:         b.Replay.Name,
+	}
+}
+
+// arrangementFor は設定の指の並べ方をバックエンドに渡す値に変換する
+// 不明な値は設定の検証で弾くため、ここでは縦一列として扱う
+func arrangementFor(arrangement string) features.Arrangement {
+	switch arrangement {
+	case config.ArrangementRow:
+		return features.ArrangeRow
+	case config.ArrangementArc:
+		return features.ArrangeArc
+	default:
+		return features.ArrangeColumn
+	}
+}
+
+// actionFor は動作の設定を実行器に渡す動作に変換する
+func actionFor(a config.ActionConfig) features.Action {
+	return features.Action{
+		Kind:    a.Kind(),
+		Keys:    a.Keys,
+		Command: a.Command,
+		IPC:     a.IPC,
+	}
+}
+
+// touchPadSpecFor は既定値を補った仮想タッチパッドの設定を、作成するデバイスの範囲と識別子に変換する
+func touchPadSpecFor(tp config.TouchPadConfig) features.TouchPadSpec {
+	tp = tp.WithDefaults()
+	return features.TouchPadSpec{
+		Bounds: features.TouchPadBounds{
+			MinX: tp.MinX,
+			MaxX: tp.MaxX,
+			MinY: tp.MinY,
+			MaxY: tp.MaxY,
+		},
+		Resolution: tp.Resolution,
+		Slots:      tp.Slots,
+		Name:       tp.Name,
+		ID: types.InputID{
+			Bustype: tp.BusType,
+			Vendor:  tp.Vendor,
+			Product: tp.Product,
+			Version: tp.Version,
+		},
+	}
+}
+
+// passthroughRulesFor はパススルーの設定をグラブしたマウスに渡す規則に変換する
+// 省略した項目は送り直す
+func passthroughRulesFor(p config.PassthroughConfig) features.PassthroughRules {
+	return features.PassthroughRules{
+		Buttons:     p.Buttons != config.PassthroughConsume,
+		SideButtons: p.SideButtons != config.PassthroughConsume,
+		Wheel:       p.Wheel != config.PassthroughConsume,
+	}
+}
+
+// strokeStore は設定ディレクトリの strokes に保存するテンプレートのストアを返す
+func (s *GestureService) strokeStore() (*features.StrokeStore, error) {
+	if s.strokes == nil {
+		return nil, fmt.Errorf("設定ディレクトリが不明なため、図形のテンプレートを保存できません")
+	}
+	return s.strokes, nil
+}
+
+// recordingStore は設定ディレクトリの recordings に保存する記録のストアを返す
+func (s *GestureService) recordingStore() (*features.RecordingStore, error) {
+	if s.recordings == nil {
+		return nil, fmt.Errorf("設定ディレクトリが不明なため、ジェスチャーの記録を保存できません")
+	}
+	return s.recordings, nil
+}
+
+// getBackend は名前に対応するバックエンドを返す。未作成の場合は作成する
+func (s *GestureService) getBackend(name string) (features.GestureBackend, error) {
+	if backend, ok := s.backends[name]; ok {
+		return backend, nil
+	}
+
+	factory, ok := backendFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("不明なバックエンドです: %s", name)
+	}
+
+	backend, err := factory(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.backends == nil {
+		s.backends = make(map[string]features.GestureBackend)
+	}
+	s.backends[name] = backend
+	log.Printf("バックエンドを作成しました: %s", name)
+	return backend, nil
+}
+
+// getKeyEmitter はバックエンド間で共有する仮想キーボードを返す。未作成の場合は作成する
+func (s *GestureService) getKeyEmitter() (features.KeyEmitter, error) {
+	if s.keyEmitter != nil {
+		return s.keyEmitter, nil
+	}
+
+	keys, err := features.CreateKeyEmitter(s.cfg.UinputPath(), []byte(keyEmitterName))
+	if err != nil {
+		return nil, fmt.Errorf("仮想キーボードの作成に失敗しました: %v", err)
+	}
+	s.keyEmitter = keys
+	return keys, nil
+}
+
+// getActionExecutor はバックエンド間で共有する動作の実行器を返す。未作成の場合は作成する
+func (s *GestureService) getActionExecutor() features.ActionExecutor {
+	if s.actions == nil {
+		// 動作はジェスチャーループから実行するため、その時点の設定を参照できる
+		s.actions = features.NewActionExecutor(s.getKeyEmitter, func() features.ActionOptions {
+			return features.ActionOptions{
+				CommandTimeout:        s.cfg.Actions.CommandTimeout,
+				MaxConcurrentCommands: s.cfg.Actions.MaxConcurrentCommands,
+				IPCSocket:             s.cfg.Actions.IPCSocket,
+			}
+		})
+	}
+	return s.actions
+}
+
+// closeBackend は作成済みのバックエンドをクローズする。次に使うときに作り直される
+func (s *GestureService) closeBackend(name string) {
+	backend, ok := s.backends[name]
+	if !ok {
+		return
+	}
+	if err := backend.Close(); err != nil {
+		log.Printf("バックエンド %s のクローズに失敗しました: %v", name, err)
+	}
+	delete(s.backends, name)
+}
+
+// closeBackends は作成済みのバックエンドと共有デバイスをすべてクローズする
+func (s *GestureService) closeBackends() {
+	for name, backend := range s.backends {
+		if err := backend.Close(); err != nil {
+			log.Printf("バックエンド %s のクローズに失敗しました: %v", name, err)
+		}
+	}
+	s.backends = nil
+
+	if s.actions != nil {
+		_ = s.actions.Close()
+		s.actions = nil
+	}
+
+	if s.keyEmitter != nil {
+		_ = s.keyEmitter.Close()
+		s.keyEmitter = nil
+	}
+}
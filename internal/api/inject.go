@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/features"
+)
+
+// ジェスチャー注入ジョブの状態
+const (
+	InjectJobRunning   = "running"
+	InjectJobCompleted = "completed"
+	InjectJobFailed    = "failed"
+	InjectJobCanceled  = "canceled" // 利用者のジェスチャーが始まったため中断した
+)
+
+// 保持するジョブの最大数。超えた場合は終了したジョブから古い順に破棄する
+const maxInjectJobs = 100
+
+// ErrGestureInProgress は利用者のジェスチャー中に注入しようとしたときのエラー
+var ErrGestureInProgress = errors.New("ジェスチャーの実行中です")
+
+// InjectJob はジェスチャー注入の進み具合を表す
+type InjectJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// injectJobs は注入ジョブを ID で管理する
+type injectJobs struct {
+	mu    sync.Mutex
+	jobs  map[string]*InjectJob
+	order []string // 作成順の ID
+}
+
+// InjectGesture は宣言的に指定したジェスチャーを仮想タッチパッドで再生し、ジョブの ID を返す
+// 利用者のジェスチャー中や別の再生中は実行しない
+func (s *GestureService) InjectGesture(spec features.GestureSpec) (string, error) {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+
+	if !s.running || s.player == nil {
+		return "", fmt.Errorf("サービスは実行されていません")
+	}
+	if s.gestureActive.Load() {
+		return "", ErrGestureInProgress
+	}
+
+	rec, err := features.BuildRecording(spec, s.touchRecorder.Bounds())
+	if err != nil {
+		return "", err
+	}
+	result, err := s.player.Play(rec)
+	if err != nil {
+		return "", err
+	}
+
+	job := s.injectJobs.add()
+	log.Printf("ジェスチャーを注入します: job=%s, fingers=%d, duration=%dms", job.ID, spec.Fingers, spec.DurationMs)
+	go func() {
+		err := <-result
+		s.injectJobs.finish(job.ID, err)
+	}()
+	return job.ID, nil
+}
+
+// InjectJob は ID に対応するジョブの状態を返す
+func (s *GestureService) InjectJob(id string) (InjectJob, bool) {
+	return s.injectJobs.get(id)
+}
+
+func (j *injectJobs) add() InjectJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.jobs == nil {
+		j.jobs = make(map[string]*InjectJob)
+	}
+	j.prune()
+
+	job := &InjectJob{ID: newJobID(), Status: InjectJobRunning, CreatedAt: time.Now()}
+	j.jobs[job.ID] = job
+	j.order = append(j.order, job.ID)
+	return *job
+}
+
+func (j *injectJobs) finish(id string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case err == nil:
+		job.Status = InjectJobCompleted
+	case errors.Is(err, context.Canceled):
+		job.Status = InjectJobCanceled
+	default:
+		job.Status = InjectJobFailed
+		job.Error = err.Error()
+	}
+}
+
+func (j *injectJobs) get(id string) (InjectJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return InjectJob{}, false
+	}
+	return *job, true
+}
+
+// prune は保持数を超えた終了済みのジョブを古い順に破棄する。呼び出し側で mu をロックしておくこと
+func (j *injectJobs) prune() {
+	for i := 0; len(j.order) >= maxInjectJobs && i < len(j.order); {
+		id := j.order[i]
+		if j.jobs[id].Status == InjectJobRunning {
+			i++
+			continue
+		}
+		delete(j.jobs, id)
+		j.order = append(j.order[:i], j.order[i+1:]...)
+	}
+}
+
+// newJobID はジョブのランダムな ID を返す
+func newJobID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -2,9 +2,13 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/char5742/keyball-gestures/internal/config"
 	"github.com/char5742/keyball-gestures/internal/features"
@@ -26,6 +30,27 @@ func (s *Server) setupRoutes(router *http.ServeMux) {
 	router.HandleFunc("POST /api/service/stop", s.handleStopService)
 	router.HandleFunc("GET /api/service/status", s.handleServiceStatus)
 
+	// 図形のテンプレート関連のエンドポイント
+	router.HandleFunc("GET /api/strokes", s.handleListStrokes)
+	router.HandleFunc("POST /api/strokes", s.handleAddStroke)
+	router.HandleFunc("POST /api/strokes/record", s.handleRecordStroke)
+	router.HandleFunc("DELETE /api/strokes/{name}", s.handleDeleteStroke)
+
+	// ジェスチャーの記録関連のエンドポイント
+	router.HandleFunc("GET /api/recordings", s.handleListRecordings)
+	router.HandleFunc("POST /api/recordings/record", s.handleRecordGesture)
+	router.HandleFunc("POST /api/recordings/{name}/play", s.handlePlayRecording)
+	router.HandleFunc("DELETE /api/recordings/{name}", s.handleDeleteRecording)
+
+	// ジェスチャー注入のエンドポイント
+	router.HandleFunc("POST /api/gestures/inject", s.handleInjectGesture)
+	router.HandleFunc("GET /api/gestures/jobs/{id}", s.handleGetInjectJob)
+
+	// 仮想デバイス関連のエンドポイント
+	router.HandleFunc("GET /api/virtual-devices", s.handleListVirtualDevices)
+	router.HandleFunc("POST /api/virtual-devices/{id}/recreate", s.handleRecreateVirtualDevice)
+	router.HandleFunc("DELETE /api/virtual-devices/{id}", s.handleDestroyVirtualDevice)
+
 	// ヘルスチェック用エンドポイント
 	router.HandleFunc("GET /api/health", s.handleHealthCheck)
 }
@@ -37,14 +62,21 @@ func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 
 // 設定更新ハンドラ
 func (s *Server) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
-	var newConfig config.Config
+	// 設定ファイルの読み込みと同じく、省略された項目は既定値のままにする
+	newConfig := config.DefaultConfig()
 
-	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(newConfig); err != nil {
 		writeError(w, http.StatusBadRequest, "設定の解析に失敗しました")
 		return
 	}
 
-	s.UpdateConfig(&newConfig)
+	if err := newConfig.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.UpdateConfig(newConfig)
+	s.getGestureService().UpdateConfig(newConfig)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
@@ -60,6 +92,9 @@ func (s *Server) handleSaveConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	configPath := saveRequest.Path
+	if configPath == "" {
+		configPath = s.configPath
+	}
 	if configPath == "" {
 		// デフォルトパスを使用
 		userConfigDir, err := config.GetDefaultConfigDir()
@@ -104,22 +139,36 @@ func (s *Server) handleSetPreferredDevices(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	cfg := s.GetConfig()
+	// 実行中のサービスが参照している設定は書き換えず、複製を渡す
+	cfg := *s.GetConfig()
 	cfg.DevicePrefs.PreferredKeyboardDevice = request.KeyboardDevice
 	cfg.DevicePrefs.PreferredMouseDevice = request.MouseDevice
-	s.UpdateConfig(cfg)
+	s.UpdateConfig(&cfg)
+	s.getGestureService().UpdateConfig(&cfg)
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
 // ジェスチャー認識サービス
-var gestureService *GestureService
+var (
+	gestureService      *GestureService
+	gestureServiceMutex sync.Mutex
+)
 
-// サービス起動ハンドラ
-func (s *Server) handleStartService(w http.ResponseWriter, r *http.Request) {
+// getGestureService はジェスチャー認識サービスを返す。未作成の場合は作成する
+// 図形のテンプレートなどの保存先はサービスが持つため、サービスを起動する前でも作成する
+func (s *Server) getGestureService() *GestureService {
+	gestureServiceMutex.Lock()
+	defer gestureServiceMutex.Unlock()
 	if gestureService == nil {
-		gestureService = NewGestureService(s.GetConfig())
+		gestureService = NewGestureService(s.GetConfig(), s.configDir())
 	}
+	return gestureService
+}
+
+// サービス起動ハンドラ
+func (s *Server) handleStartService(w http.ResponseWriter, r *http.Request) {
+	gestureService := s.getGestureService()
 
 	if gestureService.IsRunning() {
 		writeJSON(w, http.StatusOK, map[string]string{"status": "already_running"})
@@ -136,7 +185,9 @@ func (s *Server) handleStartService(w http.ResponseWriter, r *http.Request) {
 
 // サービス停止ハンドラ
 func (s *Server) handleStopService(w http.ResponseWriter, r *http.Request) {
-	if gestureService == nil || !gestureService.IsRunning() {
+	gestureService := s.getGestureService()
+
+	if !gestureService.IsRunning() {
 		writeJSON(w, http.StatusOK, map[string]string{"status": "not_running"})
 		return
 	}
@@ -152,13 +203,291 @@ func (s *Server) handleStopService(w http.ResponseWriter, r *http.Request) {
 // サービス状態取得ハンドラ
 func (s *Server) handleServiceStatus(w http.ResponseWriter, r *http.Request) {
 	status := "stopped"
-	if gestureService != nil && gestureService.IsRunning() {
+	if s.getGestureService().IsRunning() {
 		status = "running"
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": status})
 }
 
+// 図形のテンプレート一覧取得ハンドラ
+func (s *Server) handleListStrokes(w http.ResponseWriter, r *http.Request) {
+	store, err := s.getGestureService().strokeStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	templates, err := store.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "テンプレートの取得に失敗しました: "+err.Error())
+		return
+	}
+
+	type strokeSummary struct {
+		Name    string `json:"name"`
+		Samples int    `json:"samples"`
+	}
+	summaries := make([]strokeSummary, 0, len(templates))
+	for _, t := range templates {
+		summaries = append(summaries, strokeSummary{Name: t.Name, Samples: len(t.Samples)})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"templates": summaries,
+		"recording": store.Recording(),
+	})
+}
+
+// 図形のテンプレート追加ハンドラ（点列を直接指定する）
+func (s *Server) handleAddStroke(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name   string                 `json:"name"`
+		Points []features.StrokePoint `json:"points"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "リクエストの解析に失敗しました")
+		return
+	}
+
+	store, err := s.getGestureService().strokeStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := store.Add(request.Name, request.Points); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "success", "name": request.Name})
+}
+
+// 図形の記録予約ハンドラ
+// 次に stroke バックエンドのキーを押して描いた図形がテンプレートとして保存される
+func (s *Server) handleRecordStroke(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "リクエストの解析に失敗しました")
+		return
+	}
+
+	store, err := s.getGestureService().strokeStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := store.Record(request.Name); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "recording", "name": request.Name})
+}
+
+// 図形のテンプレート削除ハンドラ
+func (s *Server) handleDeleteStroke(w http.ResponseWriter, r *http.Request) {
+	store, err := s.getGestureService().strokeStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := store.Delete(r.PathValue("name")); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// ジェスチャーの記録一覧取得ハンドラ
+func (s *Server) handleListRecordings(w http.ResponseWriter, r *http.Request) {
+	store, err := s.getGestureService().recordingStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	recordings, err := store.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "記録の取得に失敗しました: "+err.Error())
+		return
+	}
+
+	type recordingSummary struct {
+		Name       string    `json:"name"`
+		RecordedAt time.Time `json:"recorded_at"`
+		Frames     int       `json:"frames"`
+		DurationMs int64     `json:"duration_ms"`
+	}
+	summaries := make([]recordingSummary, 0, len(recordings))
+	for _, rec := range recordings {
+		summaries = append(summaries, recordingSummary{
+			Name:       rec.Name,
+			RecordedAt: rec.RecordedAt,
+			Frames:     len(rec.Frames),
+			DurationMs: rec.Duration().Milliseconds(),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"recordings": summaries,
+		"recording":  store.Recording(),
+	})
+}
+
+// ジェスチャーの記録予約ハンドラ
+// 次に touchpad バックエンドのキーを押して行ったジェスチャーが記録される
+func (s *Server) handleRecordGesture(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "リクエストの解析に失敗しました")
+		return
+	}
+
+	store, err := s.getGestureService().recordingStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := store.Record(request.Name); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "recording", "name": request.Name})
+}
+
+// ジェスチャーの記録再生ハンドラ
+func (s *Server) handlePlayRecording(w http.ResponseWriter, r *http.Request) {
+	gestureService := s.getGestureService()
+	store, err := gestureService.recordingStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rec, err := store.Load(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if !gestureService.IsRunning() {
+		writeError(w, http.StatusServiceUnavailable, "サービスは実行されていません")
+		return
+	}
+	if err := gestureService.PlayRecording(rec); err != nil {
+		if errors.Is(err, features.ErrPlaybackBusy) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "記録の再生に失敗しました: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "playing", "name": rec.Name})
+}
+
+// ジェスチャーの記録削除ハンドラ
+func (s *Server) handleDeleteRecording(w http.ResponseWriter, r *http.Request) {
+	store, err := s.getGestureService().recordingStore()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := store.Delete(r.PathValue("name")); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// ジェスチャー注入ハンドラ
+func (s *Server) handleInjectGesture(w http.ResponseWriter, r *http.Request) {
+	var spec features.GestureSpec
+
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		writeError(w, http.StatusBadRequest, "リクエストの解析に失敗しました")
+		return
+	}
+
+	gestureService := s.getGestureService()
+	if !gestureService.IsRunning() {
+		writeError(w, http.StatusServiceUnavailable, "サービスは実行されていません")
+		return
+	}
+	id, err := gestureService.InjectGesture(spec)
+	if err != nil {
+		if errors.Is(err, ErrGestureInProgress) || errors.Is(err, features.ErrPlaybackBusy) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": InjectJobRunning, "id": id})
+}
+
+// ジェスチャー注入ジョブの状態取得ハンドラ
+func (s *Server) handleGetInjectJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.getGestureService().InjectJob(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "ジョブが見つかりません")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+// 仮想デバイス一覧取得ハンドラ
+func (s *Server) handleListVirtualDevices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, features.VirtualDevices())
+}
+
+// 仮想デバイス作り直しハンドラ
+func (s *Server) handleRecreateVirtualDevice(w http.ResponseWriter, r *http.Request) {
+	s.handleVirtualDeviceOp(w, r, false)
+}
+
+// 仮想デバイス破棄ハンドラ
+func (s *Server) handleDestroyVirtualDevice(w http.ResponseWriter, r *http.Request) {
+	s.handleVirtualDeviceOp(w, r, true)
+}
+
+// handleVirtualDeviceOp は仮想デバイスの作り直しと破棄の共通処理
+func (s *Server) handleVirtualDeviceOp(w http.ResponseWriter, r *http.Request, destroy bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "仮想デバイスのIDが不正です")
+		return
+	}
+	gestureService := s.getGestureService()
+	if destroy {
+		err = gestureService.DestroyVirtualDevice(id)
+	} else {
+		err = gestureService.RecreateVirtualDevice(id)
+	}
+	switch {
+	case errors.Is(err, ErrServiceNotRunning):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, ErrVirtualDeviceNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrVirtualDeviceRequired), errors.Is(err, ErrGestureInProgress):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	}
+}
+
 // ヘルスチェックハンドラ
 func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/char5742/keyball-gestures/internal/config"
+)
+
+// newTestServer はルートを設定したサーバーを作成する
+// ジェスチャー認識サービスはパッケージで共有するため、テストの終わりに破棄する
+func newTestServer(t *testing.T) (*Server, *http.ServeMux) {
+	t.Helper()
+	gestureServiceMutex.Lock()
+	gestureService = nil
+	gestureServiceMutex.Unlock()
+	t.Cleanup(func() {
+		gestureServiceMutex.Lock()
+		gestureService = nil
+		gestureServiceMutex.Unlock()
+	})
+
+	s := NewServer(config.DefaultConfig(), "", 0)
+	router := http.NewServeMux()
+	s.setupRoutes(router)
+	return s, router
+}
+
+func putConfig(t *testing.T, router http.Handler, body string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/api/config", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("設定の更新に失敗しました: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUpdateConfigReachesStoppedService(t *testing.T) {
+	s, router := newTestServer(t)
+	service := s.getGestureService()
+
+	putConfig(t, router, `{"TouchPad": {"Slots": 6}}`)
+
+	if got := s.GetConfig().TouchPad.Slots; got != 6 {
+		t.Fatalf("サーバーの設定が更新されていません: slots=%d", got)
+	}
+	// 停止中のサービスは次の起動で新しい設定を使う
+	if service.cfg != s.GetConfig() {
+		t.Fatal("停止中のサービスに設定が渡されていません")
+	}
+}
+
+func TestUpdateConfigReachesRunningService(t *testing.T) {
+	s, router := newTestServer(t)
+	service := s.getGestureService()
+	// ジェスチャーループの代わりに設定の更新を受け取る
+	service.statusMutex.Lock()
+	service.running = true
+	service.statusMutex.Unlock()
+
+	putConfig(t, router, `{"TouchPad": {"Slots": 6}}`)
+
+	select {
+	case cfg := <-service.updateConfig:
+		if cfg.TouchPad.Slots != 6 {
+			t.Fatalf("ループに渡した設定が違います: slots=%d", cfg.TouchPad.Slots)
+		}
+	default:
+		t.Fatal("実行中のサービスに設定が渡されていません")
+	}
+
+	// 優先デバイスの変更も、元の設定を書き換えずにループへ渡す
+	before := s.GetConfig()
+	req := httptest.NewRequest(http.MethodPut, "/api/devices/preferred", strings.NewReader(`{"mouse_device": "/dev/input/event7"}`))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("優先デバイスの設定に失敗しました: %d %s", rec.Code, rec.Body)
+	}
+	select {
+	case cfg := <-service.updateConfig:
+		if cfg.DevicePrefs.PreferredMouseDevice != "/dev/input/event7" || cfg.TouchPad.Slots != 6 {
+			t.Fatalf("ループに渡した設定が違います: %+v", cfg.DevicePrefs)
+		}
+	default:
+		t.Fatal("優先デバイスの変更がサービスに渡されていません")
+	}
+	if before.DevicePrefs.PreferredMouseDevice != "" {
+		t.Fatal("サービスが参照している設定が書き換えられました")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io/fs"
 	"log"
 	"net/http"
+	"path/filepath"
 	"sync"
 
 	"github.com/char5742/keyball-gestures/internal/config"
@@ -18,20 +19,31 @@ var staticFiles embed.FS
 
 // Server はAPIサーバーを表す構造体
 type Server struct {
-	server *http.Server
-	cfg    *config.Config
-	mutex  sync.RWMutex
-	port   int
+	server     *http.Server
+	cfg        *config.Config
+	configPath string // 読み込んだ設定ファイルのパス。不明な場合は空
+	mutex      sync.RWMutex
+	port       int
 }
 
 // NewServer は新しいAPIサーバーを作成する
-func NewServer(cfg *config.Config, port int) *Server {
+// configPath は読み込んだ設定ファイルのパスで、設定の保存先と図形のテンプレートなどの保存先に使う
+func NewServer(cfg *config.Config, configPath string, port int) *Server {
 	return &Server{
-		cfg:  cfg,
-		port: port,
+		cfg:        cfg,
+		configPath: configPath,
+		port:       port,
 	}
 }
 
+// configDir は設定ファイルのディレクトリを返す。不明な場合は空を返す
+func (s *Server) configDir() string {
+	if s.configPath == "" {
+		return ""
+	}
+	return filepath.Dir(s.configPath)
+}
+
 // Start はAPIサーバーを開始する
 func (s *Server) Start() error {
 	// ルーターの設定
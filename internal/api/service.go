@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/char5742/keyball-gestures/internal/config"
@@ -26,17 +28,37 @@ type GestureService struct {
 	updateConfig          chan *config.Config
 	deviceMonitor         *features.DeviceMonitor
 	reconnectOnDisconnect bool
+	passthrough           features.Pointer
+	touchRecorder         *features.TouchRecorder
+	player                *features.TouchPlayer
+	touchPadSpec          features.TouchPadSpec // 仮想タッチパッドを作成したときの範囲と識別子
+	touchPadPath          string                // 仮想タッチパッドの作成に使った uinput のパス
+	gestureActive         atomic.Bool           // 利用者がトリガーキーを押している間は true
+	injectJobs            injectJobs
+	deviceOps             chan deviceOp // API からの仮想デバイスの作り直しと破棄の要求
+	backends              map[string]features.GestureBackend
+	keyEmitter            features.KeyEmitter
+	actions               features.ActionExecutor
+	strokes               *features.StrokeStore    // 図形のテンプレートの保存先。設定ディレクトリが不明な場合は nil
+	recordings            *features.RecordingStore // タッチ操作の記録の保存先。設定ディレクトリが不明な場合は nil
 }
 
 // NewGestureService は新しいジェスチャー認識サービスを作成する
-func NewGestureService(cfg *config.Config) *GestureService {
-	return &GestureService{
+// configDir は読み込んだ設定ファイルのディレクトリで、図形のテンプレートなどをその下に保存する
+func NewGestureService(cfg *config.Config, configDir string) *GestureService {
+	s := &GestureService{
 		cfg:                   cfg,
 		stopChan:              make(chan struct{}),
 		running:               false,
 		updateConfig:          make(chan *config.Config, 1),
+		deviceOps:             make(chan deviceOp),
 		reconnectOnDisconnect: true, // デフォルトで自動再接続を有効化
 	}
+	if configDir != "" {
+		s.strokes = features.NewStrokeStore(filepath.Join(configDir, "strokes"))
+		s.recordings = features.NewRecordingStore(filepath.Join(configDir, "recordings"))
+	}
+	return s
 }
 
 // Start はジェスチャー認識サービスを開始する
@@ -52,12 +74,11 @@ func (s *GestureService) Start() error {
 
 	// 仮想タッチパッドデバイスの作成
 	log.Println("仮想タッチパッドデバイスを作成します")
-	padDevice, err := features.CreateTouchPad("/dev/uinput", []byte("VirtualTouchPad"),
-		s.cfg.TouchPad.MinX, s.cfg.TouchPad.MaxX, s.cfg.TouchPad.MinY, s.cfg.TouchPad.MaxY)
+	recorder, err := newTouchPad(s.cfg)
 	if err != nil {
 		return fmt.Errorf("仮想タッチパッドの作成に失敗しました: %v", err)
 	}
-	s.touchPad = padDevice
+	s.setTouchPad(recorder, s.cfg)
 	log.Println("仮想タッチパッドデバイスの作成に成功しました")
 
 	// デバイス一覧の取得（デバイスモニターを使用せずに直接取得）
@@ -150,12 +171,17 @@ func (s *GestureService) Start() error {
 	}
 	s.mouse = mouse
 	log.Println("マウスデバイスのオープンに成功しました")
+	s.attachPassthrough(mouse)
 
 	log.Printf("キーボードデバイスをオープン: %s", keyboardDevice.Path)
-	keyboard, err := features.CreateKeyboard(keyboardDevice.Path)
+	keyboard, err := s.openKeyboard(keyboardDevice.Path)
 	if err != nil {
 		s.touchPad.Close()
 		s.mouse.Close()
+		if s.passthrough != nil {
+			s.passthrough.Close()
+			s.passthrough = nil
+		}
 		return fmt.Errorf("キーボードデバイスのオープンに失敗しました: %v", err)
 	}
 	s.keyboard = keyboard
@@ -237,6 +263,39 @@ func (s *GestureService) Start() error {
 	return nil
 }
 
+// attachPassthrough はジェスチャー中にグラブしたマウスのボタンやホイールを送り直す仮想マウスを設定する
+// 仮想マウスは最初に必要になったときに作成し、再接続後のマウスでも使い回す
+// 無効な場合は送り直しをやめ、作成済みの仮想マウスを閉じる
+func (s *GestureService) attachPassthrough(mouse features.Mouse) {
+	if !s.cfg.Passthrough.Enabled {
+		mouse.SetPassthrough(nil, features.PassthroughRules{})
+		if s.passthrough != nil {
+			_ = s.passthrough.Close()
+			s.passthrough = nil
+		}
+		return
+	}
+
+	if s.passthrough == nil {
+		pointer, err := features.CreatePointer(s.cfg.UinputPath(), []byte(passthroughMouseName))
+		if err != nil {
+			log.Printf("警告: パススルー用の仮想マウスの作成に失敗しました: %v", err)
+			return
+		}
+		s.passthrough = pointer
+	}
+	mouse.SetPassthrough(s.passthrough, passthroughRulesFor(s.cfg.Passthrough))
+}
+
+// openKeyboard は設定に従ってキーボードを開く
+// グラブする場合はトリガーキー以外を仮想キーボードから送り直す
+func (s *GestureService) openKeyboard(path string) (features.Keyboard, error) {
+	if !s.cfg.Keyboard.Grab {
+		return features.CreateKeyboard(path)
+	}
+	return features.CreateGrabbedKeyboard(path, s.cfg.UinputPath(), []byte(passthroughKeyboardName), s.cfg.SwallowKeys())
+}
+
 // 再接続を試みる新しいメソッド
 func (s *GestureService) attemptReconnect() {
 	// サービスが実行中でなければ何もしない
@@ -353,7 +412,7 @@ func (s *GestureService) attemptReconnect() {
 
 		// 新しいデバイスを開く
 		log.Printf("キーボードデバイスをオープン: %s", keyboardDevice.Path)
-		keyboard, err := features.CreateKeyboard(keyboardDevice.Path)
+		keyboard, err := s.openKeyboard(keyboardDevice.Path)
 		if err != nil {
 			log.Printf("キーボードデバイスのオープンに失敗しました: %v", err)
 			s.statusMutex.Unlock()
@@ -374,6 +433,7 @@ func (s *GestureService) attemptReconnect() {
 		// デバイスの参照を更新
 		s.keyboard = keyboard
 		s.mouse = mouse
+		s.attachPassthrough(mouse)
 		s.keyboardDevice = keyboardDevice
 		s.mouseDevice = mouseDevice
 
@@ -424,7 +484,21 @@ func (s *GestureService) SetAutoReconnect(enable bool) {
 }
 
 // UpdateConfig は設定を更新する
+// 実行中はジェスチャーループが次の周回で反映し、停止中は次に起動したときに使う
 func (s *GestureService) UpdateConfig(cfg *config.Config) {
+	s.statusMutex.Lock()
+	if !s.running {
+		// 反映するループがないため直接置き換え、停止前に送った古い設定は捨てる
+		select {
+		case <-s.updateConfig:
+		default:
+		}
+		s.cfg = cfg
+		s.statusMutex.Unlock()
+		return
+	}
+	s.statusMutex.Unlock()
+
 	select {
 	case s.updateConfig <- cfg:
 		// 設定更新チャネルに送信成功
@@ -448,26 +522,38 @@ func (s *GestureService) IsRunning() bool {
 // runGestureLoop はジェスチャー認識のメインループ
 func (s *GestureService) runGestureLoop() {
 	defer func() {
-		// サービス終了時にデバイスをクローズ
+		// サービス終了時にバックエンドとデバイスをクローズ
+		if s.player != nil {
+			s.player.Stop()
+		}
+		s.closeBackends()
 		if s.touchPad != nil {
 			s.touchPad.Close()
 		}
 		if s.mouse != nil {
 			s.mouse.Close()
 		}
+		if s.passthrough != nil {
+			s.passthrough.Close()
+			s.passthrough = nil
+		}
 		if s.keyboard != nil {
 			s.keyboard.Close()
 		}
 		log.Println("ジェスチャー認識サービスを停止しました")
 	}()
 
-	const maxFingers = 4
 	var (
-		fingerCount     int
-		fingerPositions [maxFingers]struct{ x, y int32 }
-		prevKey         int32
-		grabbed         bool
-		lastScrollTime  time.Time
+		prevKey       int32
+		grabbed       bool
+		active        *config.BindingConfig
+		activeBackend features.GestureBackend
+		hold          *features.HoldRecognizer // 長押しの判定中のみ設定される
+		recordingName string                   // 記録中のジェスチャーの名前
+
+		// 仮想タッチパッドの作り直しを待っているか
+		// 指を置いたまま作り直さないよう、ジェスチャーの合間まで待つ
+		touchPadPending bool
 	)
 
 	// 設定値を取得するための関数（設定更新に対応）
@@ -482,16 +568,97 @@ func (s *GestureService) runGestureLoop() {
 	}
 
 	cfg := getCfg()
+	bindingsCfg := cfg
+	bindings := cfg.ActiveBindings()
 	motionFilter := features.NewMotionFilter(cfg.Motion.FilterSmoothingFactor, cfg.Motion.FilterWarmUpCount)
 
+	// 実行中のジェスチャーを終了する
+	endGesture := func() {
+		if activeBackend != nil {
+			if err := activeBackend.End(); err != nil {
+				log.Printf("ジェスチャーの終了に失敗しました: %v", err)
+			}
+		}
+		if recordingName != "" {
+			s.saveRecording(recordingName)
+			recordingName = ""
+		}
+		log.Println("ジェスチャー終了")
+		motionFilter.Reset()
+		s.gestureActive.Store(false)
+		active = nil
+		activeBackend = nil
+		hold = nil
+	}
+
+	// バインディングのバックエンドを開始する
+	beginGesture := func(binding *config.BindingConfig) {
+		backend, err := s.getBackend(binding.Backend)
+		if err != nil {
+			// キーが離されるまでこのバインディングは何も出力しない
+			log.Printf("バックエンド %s の取得に失敗しました: %v", binding.Backend, err)
+			return
+		}
+		log.Printf("ジェスチャー開始: key=%d, backend=%s, mode=%s", binding.Key, binding.Backend, binding.Mode)
+		if binding.Backend == config.BackendTouchPad {
+			// 利用者のジェスチャーを優先し、再生中の操作は中断して指を離す
+			s.player.Stop()
+			recordingName = s.startRecording()
+		}
+		if err := backend.Begin(gestureFor(*binding, cfg, motionFilter)); err != nil {
+			// 開始していないバックエンドには移動や終了を渡さない
+			log.Printf("ジェスチャーの開始に失敗しました: %v", err)
+			if recordingName != "" {
+				s.cancelRecording(recordingName)
+				recordingName = ""
+			}
+			return
+		}
+		activeBackend = backend
+	}
+
 	log.Println("ジェスチャー認識を開始しました...")
 
 	for {
 		select {
 		case <-s.stopChan:
+			if active != nil {
+				endGesture()
+			}
 			return
 		default:
 			cfg = getCfg()
+			if cfg != bindingsCfg {
+				passthroughChanged := cfg.Passthrough != bindingsCfg.Passthrough
+				bindingsCfg = cfg
+				bindings = cfg.ActiveBindings()
+				s.statusMutex.Lock()
+				if s.keyboard != nil {
+					s.keyboard.SetSwallowKeys(cfg.SwallowKeys())
+				}
+				if passthroughChanged && s.mouse != nil {
+					s.attachPassthrough(s.mouse)
+				}
+				s.statusMutex.Unlock()
+				if s.touchPadChanged(cfg) {
+					touchPadPending = true
+				}
+			}
+			if touchPadPending && active == nil {
+				touchPadPending = false
+				log.Println("仮想タッチパッドの設定が変更されたため作り直します")
+				if err := s.recreateTouchPad(cfg); err != nil {
+					log.Printf("警告: 仮想タッチパッドの作り直しに失敗しました。以前の設定のまま使い続けます: %v", err)
+				}
+			}
+			// 仮想デバイスの作り直しと破棄は、使用中のデバイスを壊さないようジェスチャーの合間に行う
+			if active == nil {
+				select {
+				case op := <-s.deviceOps:
+					op.result <- s.applyDeviceOp(op)
+				default:
+				}
+			}
 
 			// デバイス参照をsafeにアクセスするためにロックを取得
 			s.statusMutex.RLock()
@@ -524,19 +691,11 @@ func (s *GestureService) runGestureLoop() {
 
 			dx, dy := motionFilter.Filter(dxRaw*int32(cfg.Motion.MouseDeltaFactor), dyRaw*int32(cfg.Motion.MouseDeltaFactor))
 
-			now := time.Now()
-
-			// 何も動いていない場合、最後のスクロールから閾値を超えていればリセット
-			// これにより、タッチパッドの範囲内で無限にスクロールが可能
-			if now.Sub(lastScrollTime) > cfg.Gesture.ResetThreshold && fingerCount > 0 {
-				liftAllFingers(s.touchPad, fingerCount)
-				motionFilter.Reset()
-				initFingers(s.touchPad, &fingerPositions, fingerCount, cfg.TouchPad.MaxX/2, cfg.TouchPad.MaxY/2)
-			}
-			lastScrollTime = now
+			// 押されているキーに対応するバインディング
+			binding := findBinding(bindings, pressedKey)
 
 			switch {
-			case pressedKey == int32(cfg.Input.TwoFingerKey) && fingerCount == 0:
+			case binding != nil && active == nil:
 				if !grabbed {
 					s.statusMutex.RLock()
 					if s.mouse != nil {
@@ -545,40 +704,57 @@ func (s *GestureService) runGestureLoop() {
 					}
 					s.statusMutex.RUnlock()
 				}
-				log.Println("2本指ジェスチャー開始")
-				fingerCount = 2
-				initFingers(s.touchPad, &fingerPositions, fingerCount, cfg.TouchPad.MaxX/2, cfg.TouchPad.MaxY/2)
+				active = binding
 				prevKey = pressedKey
+				s.gestureActive.Store(true)
 
-			case pressedKey == int32(cfg.Input.FourFingerKey) && fingerCount == 0:
-				if !grabbed {
-					s.statusMutex.RLock()
-					if s.mouse != nil {
-						s.mouse.Grab()
-						grabbed = true
-					}
-					s.statusMutex.RUnlock()
+				// 長押しの動作がある場合は、動かすか長押しと判定されるまでバックエンドを開始しない
+				if binding.Hold.Kind() != "" {
+					hold = features.NewHoldRecognizer(binding.Hold.Duration, binding.Hold.DeadZone)
+					hold.Reset(time.Now())
+					break
 				}
-				log.Println("4本指ジェスチャー開始")
-				fingerCount = 4
-				initFingers(s.touchPad, &fingerPositions, fingerCount, cfg.TouchPad.MaxX/2, cfg.TouchPad.MaxY/2)
-				prevKey = pressedKey
-
-			case (pressedKey == int32(cfg.Input.FourFingerKey) || pressedKey == int32(cfg.Input.TwoFingerKey)) && fingerCount > 0:
-				if pressedKey == prevKey {
-					for i := 0; i < fingerCount; i++ {
-						fingerPositions[i].x += dx
-						fingerPositions[i].y += dy
-
-						fingerPositions[i].x = clamp(fingerPositions[i].x, cfg.TouchPad.MinX, cfg.TouchPad.MaxX)
-						fingerPositions[i].y = clamp(fingerPositions[i].y, cfg.TouchPad.MinY, cfg.TouchPad.MaxY)
-
-						_ = s.touchPad.MultiTouchMove(i, fingerPositions[i].x, fingerPositions[i].y)
+				beginGesture(binding)
+
+			case binding != nil && active != nil:
+				if pressedKey != prevKey {
+					endGesture()
+				} else if hold != nil {
+					now := time.Now()
+					switch hold.Feed(dx, dy, now) {
+					case features.HoldFired:
+						// このキー操作は長押しとして消費し、キーが離されるまで何も出力しない
+						log.Printf("長押しを認識しました: key=%d", active.Key)
+						err := s.getActionExecutor().Execute(actionFor(active.Hold.ActionConfig), features.GestureInfo{
+							Direction: "hold",
+							Fingers:   active.Fingers,
+							Duration:  hold.Elapsed(now),
+						})
+						if err != nil {
+							log.Printf("長押しの動作の実行に失敗しました: %v", err)
+						}
+						hold = nil
+					case features.HoldMoved:
+						// 不感帯の中で動かした分もまとめて渡してから通常のジェスチャーを始める
+						offsetX, offsetY := hold.Offset()
+						hold = nil
+						beginGesture(active)
+						if activeBackend != nil {
+							_ = activeBackend.Move(features.Motion{
+								DX:   int32(offsetX),
+								DY:   int32(offsetY),
+								Time: now,
+							})
+						}
 					}
-				} else {
-					liftAllFingers(s.touchPad, fingerCount)
-					motionFilter.Reset()
-					fingerCount = 0
+				} else if activeBackend != nil {
+					_ = activeBackend.Move(features.Motion{
+						DX:    dx,
+						DY:    dy,
+						RawDX: dxRaw,
+						RawDY: dyRaw,
+						Time:  time.Now(),
+					})
 				}
 				prevKey = pressedKey
 
@@ -591,10 +767,8 @@ func (s *GestureService) runGestureLoop() {
 					s.statusMutex.RUnlock()
 					grabbed = false
 				}
-				if fingerCount > 0 {
-					liftAllFingers(s.touchPad, fingerCount)
-					log.Println("ジェスチャー終了")
-					fingerCount = 0
+				if active != nil {
+					endGesture()
 				}
 				if pressedKey != 0 {
 					prevKey = pressedKey
@@ -608,6 +782,130 @@ func (s *GestureService) runGestureLoop() {
 	}
 }
 
+// newTouchPad は設定に従って仮想タッチパッドを作成する
+// ジェスチャーループと記録の再生が同じタッチパッドを使うため、操作は記録器を通して直列化する
+func newTouchPad(cfg *config.Config) (*features.TouchRecorder, error) {
+	spec := touchPadSpecFor(cfg.TouchPad)
+	padDevice, err := features.CreateTouchPad(cfg.UinputPath(), spec)
+	if err != nil {
+		return nil, err
+	}
+	return features.NewTouchRecorder(padDevice, spec.Bounds), nil
+}
+
+// setTouchPad は仮想タッチパッドと、それを使う再生器を設定する
+// Start 以外から呼び出す場合は statusMutex をロックしておくこと
+func (s *GestureService) setTouchPad(recorder *features.TouchRecorder, cfg *config.Config) {
+	s.touchRecorder = recorder
+	s.touchPad = recorder
+	s.player = features.NewTouchPlayer(recorder, recorder.Bounds())
+	s.touchPadSpec = touchPadSpecFor(cfg.TouchPad)
+	s.touchPadPath = cfg.UinputPath()
+}
+
+// touchPadChanged は設定の変更が仮想タッチパッドの機能（座標の範囲、精度、スロット数、識別子）に影響するかを返す
+func (s *GestureService) touchPadChanged(cfg *config.Config) bool {
+	return touchPadSpecFor(cfg.TouchPad) != s.touchPadSpec || cfg.UinputPath() != s.touchPadPath
+}
+
+// recreateTouchPad は新しい設定で仮想タッチパッドを作り直す
+// ジェスチャーの合間に呼び出すこと。再生中の操作は中断して指を離してから古いデバイスを破棄する
+func (s *GestureService) recreateTouchPad(cfg *config.Config) error {
+	// 作成に失敗した場合は古いタッチパッドを使い続けられるよう、先に新しいデバイスを作る
+	recorder, err := newTouchPad(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	s.player.Stop()
+	old := s.touchRecorder
+	s.setTouchPad(recorder, cfg)
+
+	// 古いタッチパッドを参照しているバックエンドは、次に使うときに作り直す
+	s.closeBackend(config.BackendTouchPad)
+	s.closeBackend(config.BackendReplay)
+
+	if err := old.Close(); err != nil {
+		log.Printf("古い仮想タッチパッドのクローズに失敗しました: %v", err)
+	}
+	log.Printf("仮想タッチパッドを作り直しました: x=%d-%d, y=%d-%d, name=%s",
+		cfg.TouchPad.MinX, cfg.TouchPad.MaxX, cfg.TouchPad.MinY, cfg.TouchPad.MaxY, s.touchPadSpec.Name)
+	return nil
+}
+
+// startRecording は記録が予約されていればタッチパッドの操作の記録を始め、その名前を返す
+func (s *GestureService) startRecording() string {
+	store, err := s.recordingStore()
+	if err != nil {
+		return ""
+	}
+	name := store.TakeRecording()
+	if name == "" {
+		return ""
+	}
+	s.touchRecorder.StartRecording()
+	log.Printf("ジェスチャーの記録を開始しました: %s", name)
+	return name
+}
+
+// cancelRecording はタッチパッドの操作の記録を保存せずに終了し、次のジェスチャーで記録するよう予約し直す
+func (s *GestureService) cancelRecording(name string) {
+	s.touchRecorder.StopRecording()
+	if store, err := s.recordingStore(); err == nil {
+		_ = store.Record(name)
+	}
+	log.Printf("ジェスチャーを開始できなかったため、記録を次のジェスチャーに持ち越します: %s", name)
+}
+
+// saveRecording はタッチパッドの操作の記録を終了して保存する
+func (s *GestureService) saveRecording(name string) {
+	store, err := s.recordingStore()
+	if err != nil {
+		log.Printf("ジェスチャーの記録の保存に失敗しました: %v", err)
+		return
+	}
+	frames := s.touchRecorder.StopRecording()
+	err = store.Save(features.TouchRecording{
+		Name:       name,
+		RecordedAt: time.Now(),
+		TouchPad:   s.touchRecorder.Bounds(),
+		Frames:     frames,
+	})
+	if err != nil {
+		log.Printf("ジェスチャーの記録の保存に失敗しました: %v", err)
+		return
+	}
+	log.Printf("ジェスチャーを記録しました: %s (%dフレーム)", name, len(frames))
+}
+
+// PlayRecording は記録したタッチ操作を仮想タッチパッドで再生する
+func (s *GestureService) PlayRecording(rec features.TouchRecording) error {
+	s.statusMutex.RLock()
+	defer s.statusMutex.RUnlock()
+
+	if !s.running || s.player == nil {
+		return fmt.Errorf("サービスは実行されていません")
+	}
+	_, err := s.player.Play(rec)
+	return err
+}
+
+// findBinding は押されたキーに対応するバインディングを返す
+func findBinding(bindings []config.BindingConfig, key int32) *config.BindingConfig {
+	if key < 0 {
+		return nil
+	}
+	for i := range bindings {
+		if int32(bindings[i].Key) == key {
+			return &bindings[i]
+		}
+	}
+	return nil
+}
+
 // runDeviceHealthCheck はデバイスの健全性チェックを定期的に実行する
 func (s *GestureService) runDeviceHealthCheck() {
 	ticker := time.NewTicker(5 * time.Second)
@@ -697,36 +995,3 @@ func (s *GestureService) isMouseDeviceAlive() bool {
 
 	return true
 }
-
-// initFingers は指の初期位置を設定する
-func initFingers(padDevice features.TouchPad, fingerPositions *[maxFingers]struct{ x, y int32 }, count int, centerX, centerY int32) {
-	offset := int32(20)
-	startY := centerY - offset*(int32(count)-1)/2
-
-	for i := 0; i < count; i++ {
-		fingerPositions[i].x = centerX
-		fingerPositions[i].y = startY + offset*int32(i)
-
-		_ = padDevice.MultiTouchDown(i, i, fingerPositions[i].x, fingerPositions[i].y)
-	}
-}
-
-// liftAllFingers はすべての指を持ち上げる
-func liftAllFingers(padDevice features.TouchPad, count int) {
-	for i := 0; i < count; i++ {
-		_ = padDevice.MultiTouchUp(i)
-	}
-}
-
-// clamp は値を最小値と最大値の間に制限する
-func clamp(value, min, max int32) int32 {
-	if value < min {
-		return min
-	}
-	if value > max {
-		return max
-	}
-	return value
-}
-
-const maxFingers = 4
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/features"
+)
+
+// 仮想デバイスの操作がジェスチャーループに受け取られるまで待つ最大時間。ジェスチャー中の場合は終わるまで待つ
+const deviceOpTimeout = 5 * time.Second
+
+var (
+	// ErrVirtualDeviceNotFound は指定した仮想デバイスが存在しないときのエラー
+	ErrVirtualDeviceNotFound = errors.New("仮想デバイスが見つかりません")
+	// ErrVirtualDeviceRequired はサービスの動作に欠かせない仮想デバイスを破棄しようとしたときのエラー
+	ErrVirtualDeviceRequired = errors.New("この仮想デバイスは破棄できません。作り直しのみ可能です")
+	// ErrServiceNotRunning はサービスが停止していて操作を受け取るジェスチャーループがないときのエラー
+	ErrServiceNotRunning = errors.New("サービスは実行されていません")
+)
+
+// deviceOp は API から要求された仮想デバイスの作り直しまたは破棄を表す
+// ジェスチャーループがジェスチャーの合間に実行し、結果を result に送る
+type deviceOp struct {
+	id      int
+	destroy bool
+	result  chan error
+}
+
+// RecreateVirtualDevice は仮想デバイスを破棄し、同じ設定で作り直す
+func (s *GestureService) RecreateVirtualDevice(id int) error {
+	return s.requestDeviceOp(id, false)
+}
+
+// DestroyVirtualDevice は仮想デバイスを破棄する
+// バックエンドや動作の実行に使う仮想デバイスは、次に必要になったときに作り直される
+func (s *GestureService) DestroyVirtualDevice(id int) error {
+	return s.requestDeviceOp(id, true)
+}
+
+// requestDeviceOp は仮想デバイスの操作をジェスチャーループに依頼し、完了を待つ
+func (s *GestureService) requestDeviceOp(id int, destroy bool) error {
+	s.statusMutex.RLock()
+	running, stop := s.running, s.stopChan
+	s.statusMutex.RUnlock()
+	if !running {
+		return ErrServiceNotRunning
+	}
+	if _, ok := features.LookupVirtualDevice(id); !ok {
+		return ErrVirtualDeviceNotFound
+	}
+
+	op := deviceOp{id: id, destroy: destroy, result: make(chan error, 1)}
+	timeout := time.NewTimer(deviceOpTimeout)
+	defer timeout.Stop()
+
+	// ジェスチャー中はループが要求を受け取らないため、受け取られるまでの時間だけを制限する
+	// 待っている間にサービスが停止した場合は、ループが要求を受け取ることはない
+	select {
+	case s.deviceOps <- op:
+	case <-stop:
+		return ErrServiceNotRunning
+	case <-timeout.C:
+		return ErrGestureInProgress
+	}
+	// 受け取ったループはその場で操作を実行して必ず結果を送るため、完了まで待つ
+	// ここで打ち切ると、実行済みの操作を失敗として返してしまう
+	return <-op.result
+}
+
+// applyDeviceOp は仮想デバイスを作り直すか破棄する。ジェスチャーループから呼び出すこと
+func (s *GestureService) applyDeviceOp(op deviceOp) error {
+	info, ok := features.LookupVirtualDevice(op.id)
+	if !ok {
+		return ErrVirtualDeviceNotFound
+	}
+	if op.destroy {
+		log.Printf("仮想デバイスを破棄します: %s (id=%d)", info.Name, info.ID)
+	} else {
+		log.Printf("仮想デバイスを作り直します: %s (id=%d)", info.Name, info.ID)
+	}
+
+	switch info.Type {
+	case features.VirtualDeviceTouchPad:
+		if op.destroy {
+			return ErrVirtualDeviceRequired
+		}
+		return s.recreateTouchPad(s.cfg)
+	case features.VirtualDevicePassthroughKeyboard:
+		return s.reopenKeyboard(!op.destroy)
+	}
+
+	if backend, ok := backendDevices[info.Name]; ok {
+		s.closeBackend(backend)
+		if op.destroy {
+			return nil
+		}
+		_, err := s.getBackend(backend)
+		return err
+	}
+
+	switch info.Name {
+	case keyEmitterName:
+		if s.keyEmitter != nil {
+			_ = s.keyEmitter.Close()
+			s.keyEmitter = nil
+		}
+		if op.destroy {
+			return nil
+		}
+		_, err := s.getKeyEmitter()
+		return err
+
+	case passthroughMouseName:
+		s.statusMutex.Lock()
+		defer s.statusMutex.Unlock()
+
+		if s.passthrough != nil {
+			_ = s.passthrough.Close()
+			s.passthrough = nil
+		}
+		if s.mouse == nil {
+			return nil
+		}
+		if op.destroy {
+			// 次の再接続まではグラブ中のボタンやホイールを送り直さない
+			s.mouse.SetPassthrough(nil, features.PassthroughRules{})
+			return nil
+		}
+		s.attachPassthrough(s.mouse)
+		return nil
+	}
+
+	return fmt.Errorf("この仮想デバイスは操作できません: %s", info.Name)
+}
+
+// reopenKeyboard はグラブしたキーボードを開き直して送り直し用の仮想キーボードを作り直す
+// grab が false の場合は、次の再接続まではグラブせずにキーボードを監視する
+func (s *GestureService) reopenKeyboard(grab bool) error {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	if s.keyboardDevice == nil {
+		return fmt.Errorf("キーボードが接続されていません")
+	}
+	if s.keyboard != nil {
+		_ = s.keyboard.Close()
+		s.keyboard = nil
+	}
+
+	var (
+		keyboard features.Keyboard
+		err      error
+	)
+	if grab {
+		keyboard, err = s.openKeyboard(s.keyboardDevice.Path)
+	} else {
+		keyboard, err = features.CreateKeyboard(s.keyboardDevice.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("キーボードを開き直せませんでした: %w", err)
+	}
+	s.keyboard = keyboard
+	return nil
+}
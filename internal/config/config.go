@@ -1,11 +1,15 @@
 package config
 
 import (
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/utils"
 )
 
 // GetDefaultConfigDir はデフォルトの設定ディレクトリのパスを返す
@@ -25,6 +29,11 @@ type Config struct {
 	Motion      MotionConfig      `toml:"motion"`
 	Gesture     GestureConfig     `toml:"gesture"`
 	DevicePrefs DevicePrefsConfig `toml:"device_prefs"`
+	Actions     ActionsConfig     `toml:"actions"`
+	Passthrough PassthroughConfig `toml:"passthrough"`
+	Keyboard    KeyboardConfig    `toml:"keyboard"`
+	Uinput      UinputConfig      `toml:"uinput"`
+	Bindings    []BindingConfig   `toml:"bindings"`
 }
 
 // TouchPadConfig は仮想タッチパッドの設定
@@ -33,6 +42,56 @@ type TouchPadConfig struct {
 	MaxX int32 `toml:"max_x"`
 	MinY int32 `toml:"min_y"`
 	MaxY int32 `toml:"max_y"`
+	// 1mmあたりの座標の値。libinput はこの値からタッチパッドの大きさを求める
+	Resolution int32 `toml:"resolution"`
+	// マルチタッチスロットの数（同時に置ける指の数）
+	Slots int `toml:"slots"`
+
+	// デバイスの名前と識別子。libinput の quirks や udev ルールで仮想タッチパッドを指定するのに使う
+	Name    string `toml:"name"`
+	Vendor  uint16 `toml:"vendor"`
+	Product uint16 `toml:"product"`
+	Version uint16 `toml:"version"`
+	BusType uint16 `toml:"bus_type"`
+}
+
+// WithDefaults は指定されていない項目を既定値で補った設定を返す
+func (tp TouchPadConfig) WithDefaults() TouchPadConfig {
+	if tp.Resolution <= 0 {
+		tp.Resolution = consts.DefaultTouchPadResolution
+	}
+	if tp.Slots <= 0 {
+		tp.Slots = consts.DefaultTouchPadSlots
+	}
+	if tp.Name == "" {
+		tp.Name = consts.DefaultTouchPadName
+	}
+	if tp.Vendor == 0 {
+		tp.Vendor = consts.DefaultTouchPadVendor
+	}
+	if tp.Product == 0 {
+		tp.Product = consts.DefaultTouchPadProduct
+	}
+	if tp.Version == 0 {
+		tp.Version = consts.DefaultTouchPadVersion
+	}
+	if tp.BusType == 0 {
+		tp.BusType = consts.BusUsb
+	}
+	return tp
+}
+
+// UinputConfig は仮想デバイスの作成に使う uinput の設定
+type UinputConfig struct {
+	Path string `toml:"path"` // uinput のデバイスファイル（例: /dev/input/uinput）
+}
+
+// UinputPath は仮想デバイスの作成に使う uinput のデバイスファイルを返す
+func (c *Config) UinputPath() string {
+	if c.Uinput.Path == "" {
+		return consts.DefaultUinputPath
+	}
+	return c.Uinput.Path
 }
 
 // InputConfig はキー入力の設定
@@ -53,6 +112,278 @@ type GestureConfig struct {
 	ResetThreshold time.Duration `toml:"reset_threshold"`
 }
 
+// バインディングの動作モード
+const (
+	BindingModeGesture = "gesture" // 複数の仮想指によるスワイプジェスチャー
+	BindingModePointer = "pointer" // 1本の仮想指によるポインター操作
+)
+
+// ジェスチャーの出力先
+const (
+	BackendTouchPad  = "touchpad"  // 仮想タッチパッドの指の動きとして出力する
+	BackendWheel     = "wheel"     // 仮想マウスのホイールとして出力する
+	BackendShortcut  = "shortcut"  // スワイプの方向に応じたキー入力として出力する
+	BackendKeystroke = "keystroke" // 移動量に応じて繰り返すキー入力として出力する
+	BackendTablet    = "tablet"    // 仮想タブレットの絶対座標として出力する
+	BackendPrecision = "precision" // 倍率をかけた移動量を仮想マウスから出力する
+	BackendStroke    = "stroke"    // 描いた図形を認識して動作を実行する
+	BackendReplay    = "replay"    // 記録したタッチ操作を再生する
+)
+
+// 仮想指を置き始める位置
+const (
+	AnchorCenter = "center" // パッドの中央
+	AnchorLeft   = "left"   // 左端
+	AnchorRight  = "right"  // 右端
+	AnchorTop    = "top"    // 上端
+	AnchorBottom = "bottom" // 下端
+	AnchorCustom = "custom" // anchor_x, anchor_y で指定した座標
+)
+
+// 仮想指の並べ方
+const (
+	ArrangementColumn = "column" // 縦一列
+	ArrangementRow    = "row"    // 横一列
+	ArrangementArc    = "arc"    // 手のひらのような弧状
+)
+
+// BindingConfig はトリガーキーと動作の対応付けを表す
+type BindingConfig struct {
+	Key           int    `toml:"key"`
+	Backend       string `toml:"backend"`
+	Mode          string `toml:"mode"`
+	Fingers       int    `toml:"fingers"`
+	Anchor        string `toml:"anchor"`
+	AnchorX       int32  `toml:"anchor_x"`
+	AnchorY       int32  `toml:"anchor_y"`
+	Arrangement   string `toml:"arrangement"`
+	FingerSpacing int32  `toml:"finger_spacing"`
+	TouchMajor    int32  `toml:"touch_major"`
+	Pressure      int32  `toml:"pressure"`
+
+	Wheel     WheelConfig     `toml:"wheel"`
+	Swipe     SwipeConfig     `toml:"swipe"`
+	Keystroke KeystrokeConfig `toml:"keystroke"`
+	Tablet    TabletConfig    `toml:"tablet"`
+	Precision PrecisionConfig `toml:"precision"`
+	Stroke    StrokeConfig    `toml:"stroke"`
+	Hold      HoldConfig      `toml:"hold"`
+	Replay    ReplayConfig    `toml:"replay"`
+}
+
+// ReplayConfig は記録したタッチ操作の再生の設定
+type ReplayConfig struct {
+	Name string `toml:"name"` // 再生する記録の名前
+}
+
+// HoldConfig は長押しの設定
+// 動作を設定すると、キーを押したまま動かさずに duration が経過したときに動作を実行し、
+// そのキー操作ではバックエンドを開始しない。dead_zone を超えて動かした場合は通常どおりバックエンドを開始する
+type HoldConfig struct {
+	ActionConfig
+	Duration time.Duration `toml:"duration"`  // 長押しと判定するまでの時間
+	DeadZone float64       `toml:"dead_zone"` // 動かしていないとみなす移動量
+}
+
+// TabletConfig は仮想タブレット出力の設定
+type TabletConfig struct {
+	Gain float64 `toml:"gain"` // 移動量の倍率
+}
+
+// PrecisionConfig は精密ポインター操作の設定
+type PrecisionConfig struct {
+	Scale float64 `toml:"scale"` // トラックボールの移動量の倍率
+}
+
+// StrokeConfig は図形（ストローク）認識の設定
+type StrokeConfig struct {
+	Threshold   float64                 `toml:"threshold"`    // 認識する一致度の下限 (0-1)
+	MinDistance float64                 `toml:"min_distance"` // 認識する最小の移動量。これより短い操作は無視する
+	Actions     map[string]ActionConfig `toml:"actions"`      // テンプレート名ごとの動作
+}
+
+// validate は既定値を補った図形認識の設定を検証する
+func (s StrokeConfig) validate() error {
+	if s.Threshold < 0 || s.Threshold > 1 {
+		return fmt.Errorf("stroke の threshold は0-1で指定してください: %v", s.Threshold)
+	}
+	if s.MinDistance < 0 {
+		return fmt.Errorf("stroke の min_distance は正の値で指定してください: %v", s.MinDistance)
+	}
+	for name, action := range s.Actions {
+		if err := action.validate(); err != nil {
+			return fmt.Errorf("図形 %s の動作が不正です: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// WheelConfig はホイール出力の設定
+type WheelConfig struct {
+	DetentSize int32 `toml:"detent_size"` // ホイール1ノッチに相当する移動量
+	Invert     bool  `toml:"invert"`      // スクロール方向を反転する
+}
+
+// AnchorPoint は仮想指を置き始める座標を返す
+// 端を指定した場合は、その辺の中点を返す
+func (b BindingConfig) AnchorPoint(tp TouchPadConfig) (x int32, y int32) {
+	centerX := tp.MinX + (tp.MaxX-tp.MinX)/2
+	centerY := tp.MinY + (tp.MaxY-tp.MinY)/2
+
+	switch b.Anchor {
+	case AnchorLeft:
+		return tp.MinX, centerY
+	case AnchorRight:
+		return tp.MaxX, centerY
+	case AnchorTop:
+		return centerX, tp.MinY
+	case AnchorBottom:
+		return centerX, tp.MaxY
+	case AnchorCustom:
+		return b.AnchorX, b.AnchorY
+	default:
+		return centerX, centerY
+	}
+}
+
+// KeystrokeConfig は移動量をキー入力の繰り返しに変換する設定
+type KeystrokeConfig struct {
+	Step    float64 `toml:"step"`     // キー入力1回に相当する移動量
+	MaxRate float64 `toml:"max_rate"` // 1秒あたりの最大キー入力回数。0の場合は制限しない
+	Up      string  `toml:"up"`       // 上方向の移動で送信するキーの組み合わせ
+	Down    string  `toml:"down"`     // 下方向の移動で送信するキーの組み合わせ
+	Left    string  `toml:"left"`     // 左方向の移動で送信するキーの組み合わせ
+	Right   string  `toml:"right"`    // 右方向の移動で送信するキーの組み合わせ
+}
+
+// スワイプを同じ方向へ続けたときの動作
+const (
+	RepeatOnce   = "once"   // キーを押している間に1回だけ実行する
+	RepeatRepeat = "repeat" // 閾値の移動量ごとに繰り返し実行する
+)
+
+// SwipeConfig はスワイプ認識の設定
+type SwipeConfig struct {
+	Distance float64              `toml:"distance"` // 方向を確定する移動量
+	Velocity float64              `toml:"velocity"` // 方向を確定する最低速度（移動量/秒）。0の場合は速度を見ない
+	Left     SwipeDirectionConfig `toml:"left"`
+	Right    SwipeDirectionConfig `toml:"right"`
+	Up       SwipeDirectionConfig `toml:"up"`
+	Down     SwipeDirectionConfig `toml:"down"`
+}
+
+// SwipeDirectionConfig はスワイプの方向ごとの動作
+type SwipeDirectionConfig struct {
+	ActionConfig
+	Repeat string `toml:"repeat"`
+}
+
+// 動作の種類
+const (
+	ActionKeys    = "keys"    // 仮想キーボードからキーの組み合わせを送信する
+	ActionCommand = "command" // コマンドを実行する
+	ActionIPC     = "ipc"     // i3/sway の IPC でコマンドを送信する
+)
+
+// ActionConfig はジェスチャーを認識したときに実行する動作
+type ActionConfig struct {
+	Type    string   `toml:"type"`    // 動作の種類。省略時は設定された項目から判断する
+	Keys    string   `toml:"keys"`    // 送信するキーの組み合わせ（例: "SUPER+LEFT"）
+	Command []string `toml:"command"` // 実行するコマンドと引数。シェルは経由しない
+	IPC     string   `toml:"ipc"`     // i3/sway に送信するコマンド（例: "workspace next"）
+}
+
+// Kind は動作の種類を返す。何も設定されていない場合は空文字列を返す
+func (a ActionConfig) Kind() string {
+	switch {
+	case a.Type != "":
+		return a.Type
+	case len(a.Command) > 0:
+		return ActionCommand
+	case a.IPC != "":
+		return ActionIPC
+	case a.Keys != "":
+		return ActionKeys
+	default:
+		return ""
+	}
+}
+
+// validate は動作の設定を検証する
+func (a ActionConfig) validate() error {
+	switch a.Kind() {
+	case "":
+	case ActionKeys:
+		if _, err := utils.ParseKeyCombo(a.Keys); err != nil {
+			return fmt.Errorf("keys が不正です: %w", err)
+		}
+	case ActionCommand:
+		if len(a.Command) == 0 || a.Command[0] == "" {
+			return fmt.Errorf("command が指定されていません")
+		}
+	case ActionIPC:
+		if a.IPC == "" {
+			return fmt.Errorf("ipc が指定されていません")
+		}
+	default:
+		return fmt.Errorf("不明な動作の種類です: %s", a.Type)
+	}
+	return nil
+}
+
+// ActionsConfig は動作の実行に関する全体設定
+type ActionsConfig struct {
+	CommandTimeout        time.Duration `toml:"command_timeout"`         // コマンドの実行時間の上限
+	MaxConcurrentCommands int           `toml:"max_concurrent_commands"` // 同時に実行できるコマンドの数
+	IPCSocket             string        `toml:"ipc_socket"`              // i3/sway の IPC ソケット。空の場合は $SWAYSOCK, $I3SOCK を使用する
+}
+
+// Direction は方向名に対応する設定を返す
+func (s SwipeConfig) Direction(dir string) SwipeDirectionConfig {
+	switch dir {
+	case "left":
+		return s.Left
+	case "right":
+		return s.Right
+	case "up":
+		return s.Up
+	case "down":
+		return s.Down
+	default:
+		return SwipeDirectionConfig{}
+	}
+}
+
+// グラブ中のイベントの扱い
+const (
+	PassthroughPass    = "pass"    // 仮想マウスから送り直す
+	PassthroughConsume = "consume" // ジェスチャーが消費して送り直さない
+)
+
+// PassthroughConfig はジェスチャー中にグラブしたマウスのイベントを送り直す設定
+type PassthroughConfig struct {
+	Enabled     bool   `toml:"enabled"`      // 送り直しを有効にする
+	Buttons     string `toml:"buttons"`      // 左・右・中ボタン。省略時は "pass"
+	SideButtons string `toml:"side_buttons"` // サイドボタンなどの追加ボタン
+	Wheel       string `toml:"wheel"`        // ホイール
+}
+
+// KeyboardConfig はキーボードのグラブの設定
+// グラブすると、トリガーキーを握りつぶし、それ以外のキーを仮想キーボードから送り直す
+type KeyboardConfig struct {
+	Grab        bool  `toml:"grab"`         // キーボードをグラブする
+	SwallowKeys []int `toml:"swallow_keys"` // バインディングのキーに加えて握りつぶすキー
+}
+
+// SwallowKeys はキーボードのグラブ中に送り直さないキーの一覧を返す
+func (c *Config) SwallowKeys() []int {
+	var keys []int
+	for _, b := range c.ActiveBindings() {
+		keys = append(keys, b.Key)
+	}
+	return append(keys, c.Keyboard.SwallowKeys...)
+}
+
 // DevicePrefsConfig はデバイス設定の設定
 type DevicePrefsConfig struct {
 	PreferredKeyboardDevice string `toml:"preferred_keyboard_device"`
@@ -63,10 +394,17 @@ type DevicePrefsConfig struct {
 func DefaultConfig() *Config {
 	return &Config{
 		TouchPad: TouchPadConfig{
-			MinX: 0,
-			MaxX: 32767,
-			MinY: 0,
-			MaxY: 32767,
+			MinX:       0,
+			MaxX:       32767,
+			MinY:       0,
+			MaxY:       32767,
+			Resolution: consts.DefaultTouchPadResolution,
+			Slots:      consts.DefaultTouchPadSlots,
+			Name:       consts.DefaultTouchPadName,
+			Vendor:     consts.DefaultTouchPadVendor,
+			Product:    consts.DefaultTouchPadProduct,
+			Version:    consts.DefaultTouchPadVersion,
+			BusType:    consts.BusUsb,
 		},
 		Input: InputConfig{
 			TwoFingerKey:  184, // F14
@@ -84,7 +422,307 @@ func DefaultConfig() *Config {
 			PreferredKeyboardDevice: "",
 			PreferredMouseDevice:    "",
 		},
+		Actions: ActionsConfig{
+			CommandTimeout:        10 * time.Second,
+			MaxConcurrentCommands: 4,
+		},
+		Passthrough: PassthroughConfig{
+			Enabled:     false,
+			Buttons:     PassthroughPass,
+			SideButtons: PassthroughPass,
+			Wheel:       PassthroughPass,
+		},
+		Uinput: UinputConfig{
+			Path: consts.DefaultUinputPath,
+		},
+	}
+}
+
+// ActiveBindings は有効なバインディングの一覧を返す
+// input セクションの2本指/4本指キーを基本とし、同じキーの bindings があればそちらを優先する
+func (c *Config) ActiveBindings() []BindingConfig {
+	bindings := make([]BindingConfig, 0, len(c.Bindings)+2)
+	if c.Input.TwoFingerKey > 0 {
+		bindings = append(bindings, BindingConfig{Key: c.Input.TwoFingerKey, Fingers: 2}.withDefaults())
+	}
+	if c.Input.FourFingerKey > 0 {
+		bindings = append(bindings, BindingConfig{Key: c.Input.FourFingerKey, Fingers: 4}.withDefaults())
+	}
+
+	for _, b := range c.Bindings {
+		b = b.withDefaults()
+
+		replaced := false
+		for i := range bindings {
+			if bindings[i].Key == b.Key {
+				bindings[i] = b
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			bindings = append(bindings, b)
+		}
+	}
+	return bindings
+}
+
+// withDefaults は省略された項目に既定値を補ったバインディングを返す
+func (b BindingConfig) withDefaults() BindingConfig {
+	if b.Backend == "" {
+		b.Backend = BackendTouchPad
+	}
+	if b.Mode == "" {
+		b.Mode = BindingModeGesture
+	}
+	if b.Mode == BindingModePointer {
+		b.Fingers = 1
+	} else if b.Fingers <= 0 {
+		b.Fingers = 2
+	}
+	if b.Anchor == "" {
+		b.Anchor = AnchorCenter
+	}
+	if b.Arrangement == "" {
+		b.Arrangement = ArrangementColumn
+	}
+	if b.FingerSpacing == 0 {
+		b.FingerSpacing = consts.DefaultFingerSpacing
+	}
+	if b.TouchMajor == 0 {
+		b.TouchMajor = consts.DefaultTouchMajor
+	}
+	if b.Pressure == 0 {
+		b.Pressure = consts.DefaultPressure
+	}
+	if b.Wheel.DetentSize == 0 {
+		b.Wheel.DetentSize = consts.DefaultDetentSize
+	}
+	if b.Swipe.Distance == 0 {
+		b.Swipe.Distance = consts.DefaultSwipeDistance
+	}
+	if b.Tablet.Gain == 0 {
+		b.Tablet.Gain = consts.DefaultTabletGain
+	}
+	if b.Precision.Scale == 0 {
+		b.Precision.Scale = consts.DefaultPrecisionScale
+	}
+	if b.Stroke.Threshold == 0 {
+		b.Stroke.Threshold = consts.DefaultStrokeThreshold
+	}
+	if b.Stroke.MinDistance == 0 {
+		b.Stroke.MinDistance = consts.DefaultStrokeDistance
+	}
+	if b.Hold.Duration == 0 {
+		b.Hold.Duration = consts.DefaultHoldDuration
+	}
+	if b.Hold.DeadZone == 0 {
+		b.Hold.DeadZone = consts.DefaultHoldDeadZone
+	}
+	if b.Keystroke.Step == 0 {
+		b.Keystroke.Step = consts.DefaultKeystrokeStep
+	}
+	for _, d := range []*SwipeDirectionConfig{&b.Swipe.Left, &b.Swipe.Right, &b.Swipe.Up, &b.Swipe.Down} {
+		if d.Repeat == "" {
+			d.Repeat = RepeatOnce
+		}
+	}
+	return b
+}
+
+// Validate は設定値が仮想デバイスの軸の範囲に収まっているかを検証する
+func (c *Config) Validate() error {
+	if err := c.validateSettings(); err != nil {
+		return err
+	}
+	for _, b := range c.ActiveBindings() {
+		if err := b.validate(c.TouchPad); err != nil {
+			return fmt.Errorf("バインディング(key=%d)の設定が不正です: %w", b.Key, err)
+		}
+	}
+	return nil
+}
+
+// validateSettings はバインディング以外の設定を検証する
+func (c *Config) validateSettings() error {
+	if c.Actions.CommandTimeout <= 0 || c.Actions.MaxConcurrentCommands <= 0 {
+		return fmt.Errorf("command_timeout と max_concurrent_commands は正の値で指定してください")
+	}
+
+	for name, rule := range map[string]string{
+		"buttons":      c.Passthrough.Buttons,
+		"side_buttons": c.Passthrough.SideButtons,
+		"wheel":        c.Passthrough.Wheel,
+	} {
+		if rule != "" && rule != PassthroughPass && rule != PassthroughConsume {
+			return fmt.Errorf("passthrough の %s が不正です: %s", name, rule)
+		}
+	}
+
+	for _, key := range c.Keyboard.SwallowKeys {
+		if key <= 0 || key > consts.KeyMax {
+			return fmt.Errorf("swallow_keys のキーコードが不正です: %d", key)
+		}
+	}
+
+	tp := c.TouchPad
+	if tp.MinX >= tp.MaxX || tp.MinY >= tp.MaxY {
+		return fmt.Errorf("タッチパッドの範囲が不正です: x=%d-%d, y=%d-%d", tp.MinX, tp.MaxX, tp.MinY, tp.MaxY)
+	}
+	if tp.Resolution < 0 {
+		return fmt.Errorf("タッチパッドの resolution は正の値で指定してください: %d", tp.Resolution)
+	}
+	// 0 は既定値を使う。ジェスチャーで置く指の数より少なくはできない
+	if tp.Slots != 0 && (tp.Slots < consts.MaxFingers || tp.Slots > consts.MaxTouchPadSlots) {
+		return fmt.Errorf("タッチパッドの slots は%d-%dで指定してください: %d", consts.MaxFingers, consts.MaxTouchPadSlots, tp.Slots)
+	}
+	if len(tp.Name) >= consts.MaxNameSize {
+		return fmt.Errorf("タッチパッドの name は%dバイト未満で指定してください: %q", consts.MaxNameSize, tp.Name)
+	}
+	return nil
+}
+
+// dropInvalidBindings は不正なバインディングを警告を出して取り除く
+// 1つのバインディングの誤りで他の設定まで使えなくならないよう、残りはそのまま使う
+func (c *Config) dropInvalidBindings() {
+	valid := c.Bindings[:0]
+	for _, b := range c.Bindings {
+		if err := b.withDefaults().validate(c.TouchPad); err != nil {
+			log.Printf("警告: バインディング(key=%d)の設定が不正なため無視します: %v", b.Key, err)
+			continue
+		}
+		valid = append(valid, b)
+	}
+	c.Bindings = valid
+}
+
+// validate は既定値を補ったバインディングを検証する
+func (b BindingConfig) validate(tp TouchPadConfig) error {
+	switch b.Backend {
+	case BackendTouchPad:
+	case BackendWheel:
+		if b.Wheel.DetentSize < 0 {
+			return fmt.Errorf("detent_size は正の値で指定してください: %d", b.Wheel.DetentSize)
+		}
+	case BackendShortcut:
+		if err := b.Swipe.validate(); err != nil {
+			return err
+		}
+	case BackendKeystroke:
+		if err := b.Keystroke.validate(); err != nil {
+			return err
+		}
+	case BackendTablet:
+		if b.Tablet.Gain < 0 {
+			return fmt.Errorf("tablet の gain は正の値で指定してください: %v", b.Tablet.Gain)
+		}
+	case BackendPrecision:
+		if b.Precision.Scale < 0 {
+			return fmt.Errorf("precision の scale は正の値で指定してください: %v", b.Precision.Scale)
+		}
+	case BackendStroke:
+		if err := b.Stroke.validate(); err != nil {
+			return err
+		}
+	case BackendReplay:
+		if b.Replay.Name == "" {
+			return fmt.Errorf("replay の name が指定されていません")
+		}
+	default:
+		return fmt.Errorf("不明なバックエンドです: %s", b.Backend)
+	}
+
+	if b.Hold.Duration < 0 || b.Hold.DeadZone < 0 {
+		return fmt.Errorf("hold の duration と dead_zone は正の値で指定してください")
+	}
+	if err := b.Hold.validate(); err != nil {
+		return fmt.Errorf("hold の動作が不正です: %w", err)
+	}
+
+	switch b.Mode {
+	case BindingModeGesture, BindingModePointer:
+	default:
+		return fmt.Errorf("不明なモードです: %s", b.Mode)
+	}
+
+	if b.Fingers < 1 || b.Fingers > consts.MaxFingers {
+		return fmt.Errorf("指の本数は1-%dで指定してください: %d", consts.MaxFingers, b.Fingers)
+	}
+
+	switch b.Anchor {
+	case AnchorCenter, AnchorLeft, AnchorRight, AnchorTop, AnchorBottom:
+	case AnchorCustom:
+		if b.AnchorX < tp.MinX || b.AnchorX > tp.MaxX || b.AnchorY < tp.MinY || b.AnchorY > tp.MaxY {
+			return fmt.Errorf("アンカー座標がタッチパッドの範囲外です: (%d, %d)", b.AnchorX, b.AnchorY)
+		}
+	default:
+		return fmt.Errorf("不明なアンカーです: %s", b.Anchor)
+	}
+
+	// 指の並び全体がタッチパッドに収まることを確認する
+	if b.FingerSpacing < 0 {
+		return fmt.Errorf("指の間隔は正の値で指定してください: %d", b.FingerSpacing)
+	}
+	span := b.FingerSpacing * int32(b.Fingers-1)
+	switch b.Arrangement {
+	case ArrangementColumn:
+		if span > tp.MaxY-tp.MinY {
+			return fmt.Errorf("指の並びがタッチパッドの高さを超えています: %d > %d", span, tp.MaxY-tp.MinY)
+		}
+	case ArrangementRow, ArrangementArc:
+		if span > tp.MaxX-tp.MinX {
+			return fmt.Errorf("指の並びがタッチパッドの幅を超えています: %d > %d", span, tp.MaxX-tp.MinX)
+		}
+		// 弧状の並びでは外側の指を指の間隔の半分まで下げる
+		if b.Arrangement == ArrangementArc && b.Fingers > 1 && b.FingerSpacing/2 > tp.MaxY-tp.MinY {
+			return fmt.Errorf("指の並びがタッチパッドの高さを超えています: %d > %d", b.FingerSpacing/2, tp.MaxY-tp.MinY)
+		}
+	default:
+		return fmt.Errorf("不明な指の並べ方です: %s", b.Arrangement)
+	}
+
+	if b.TouchMajor < 0 || b.TouchMajor > consts.TouchMajorMax {
+		return fmt.Errorf("touch_major は0-%dで指定してください: %d", consts.TouchMajorMax, b.TouchMajor)
+	}
+	if b.Pressure < 0 || b.Pressure > consts.PressureMax {
+		return fmt.Errorf("pressure は0-%dで指定してください: %d", consts.PressureMax, b.Pressure)
 	}
+	return nil
+}
+
+// validate は既定値を補ったスワイプ設定を検証する
+func (s SwipeConfig) validate() error {
+	if s.Distance < 0 || s.Velocity < 0 {
+		return fmt.Errorf("スワイプの distance と velocity は正の値で指定してください")
+	}
+	for _, dir := range []string{"left", "right", "up", "down"} {
+		d := s.Direction(dir)
+		switch d.Repeat {
+		case RepeatOnce, RepeatRepeat:
+		default:
+			return fmt.Errorf("%s の repeat が不正です: %s", dir, d.Repeat)
+		}
+		if err := d.ActionConfig.validate(); err != nil {
+			return fmt.Errorf("%s の動作が不正です: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// validate は既定値を補ったキー入力変換の設定を検証する
+func (k KeystrokeConfig) validate() error {
+	if k.Step <= 0 || k.MaxRate < 0 {
+		return fmt.Errorf("keystroke の step と max_rate は正の値で指定してください")
+	}
+	for dir, keys := range map[string]string{"up": k.Up, "down": k.Down, "left": k.Left, "right": k.Right} {
+		if keys == "" {
+			continue
+		}
+		if _, err := utils.ParseKeyCombo(keys); err != nil {
+			return fmt.Errorf("keystroke の %s が不正です: %w", dir, err)
+		}
+	}
+	return nil
 }
 
 // LoadConfig は設定ファイルから設定を読み込む
@@ -113,6 +751,12 @@ func LoadConfig(configPath string) (*Config, error) {
 		return config, err
 	}
 
+	// 不正なバインディングだけを取り除き、それ以外の誤りは読み込みの失敗とする
+	if err := config.validateSettings(); err != nil {
+		return config, err
+	}
+	config.dropInvalidBindings()
+
 	return config, nil
 }
 
@@ -1,5 +1,7 @@
 package consts
 
+import "time"
+
 // UIInput デバイスの定数（uinput.hから）
 const (
 	MaxNameSize = 80         // デバイス名の最大サイズ
@@ -7,15 +9,87 @@ const (
 	DevDestroy  = 0x5502     // デバイス破棄用のIOCTL
 	SetEvBit    = 0x40045564 // イベントビット設定用のIOCTL
 	SetKeyBit   = 0x40045565 // キービット設定用のIOCTL
+	SetRelBit   = 0x40045566 // 相対座標ビット設定用のIOCTL
 	SetAbsBit   = 0x40045567 // 絶対座標ビット設定用のIOCTL
+	SetLedBit   = 0x40045569 // LEDビット設定用のIOCTL
+	DevSetup    = 0x405c5503 // デバイスの名前と識別子の設定用のIOCTL (UI_DEV_SETUP)
+	AbsSetup    = 0x401c5504 // 絶対座標軸の設定用のIOCTL (UI_ABS_SETUP)
+	GetVersion  = 0x8004552d // uinputのバージョン取得用のIOCTL (UI_GET_VERSION)
 	BusUsb      = 0x03       // USBバスタイプ
+
+	// UI_DEV_SETUP と UI_ABS_SETUP に対応するuinputの最小のバージョン（Linux 4.5以降）
+	SetupMinVersion = 5
+	// 作成したデバイスのsysfs上の名前の最大サイズ
+	SysnameSize = 64
 )
 
+// GetSysname は作成したデバイスのsysfs上の名前を取得するIOCTL (UI_GET_SYSNAME) を返す
+func GetSysname(size int) uintptr {
+	return 0x80000000 | uintptr(size)<<16 | 'U'<<8 | 44
+}
+
+// GetKeyState は押されているキーとボタンの状態を取得するIOCTL (EVIOCGKEY) を返す
+func GetKeyState(size int) uintptr {
+	return 0x80000000 | uintptr(size)<<16 | 'E'<<8 | 0x18
+}
+
 // その他のデバイス制御用定数
 const (
 	AbsSize       = 64         // 絶対座標の配列サイズ
 	EVIOCGRAB     = 0x40044590 // デバイスの排他制御用のIOCTL
+	EVIOCGREP     = 0x80084503 // キーリピートの遅延と間隔の取得用のIOCTL
 	PropPointer   = 0x00       // ポインターデバイスプロパティ
 	PropButtonpad = 0x02       // ボタンパッドプロパティ
 	SetPropBit    = 0x4004556a // プロパティビット設定用のIOCTL
 )
+
+// 仮想タッチパッドが通知する軸の範囲
+const (
+	MaxTouchPadSlots = 16  // 設定できるマルチタッチスロットの数の上限
+	TouchMajorMax    = 255 // タッチ領域の長径の最大値
+	PressureMax      = 255 // タッチ圧力の最大値
+	MaxFingers       = 4   // ジェスチャーで使用する仮想指の最大数
+
+	TabletAxisMax = 32767 // 仮想タブレットの座標の最大値
+
+	DefaultTouchPadResolution = 300 // 仮想タッチパッドの1mmあたりの座標の既定値（約109mm四方）
+	DefaultTouchPadSlots      = 10  // 仮想タッチパッドのマルチタッチスロットの数の既定値
+	TabletResolution          = 100 // 仮想タブレットの1mmあたりの座標
+)
+
+// VirtualDeviceVendor はこのアプリケーションが作成する仮想デバイスのベンダーID
+// 別のインスタンスが作成した仮想デバイスを監視対象から除くのにも使う
+const VirtualDeviceVendor = 0x4711
+
+// 仮想タッチパッドの識別子の既定値
+const (
+	DefaultUinputPath      = "/dev/uinput"
+	DefaultTouchPadName    = "VirtualTouchPad"
+	DefaultTouchPadVendor  = VirtualDeviceVendor
+	DefaultTouchPadProduct = 0x0817
+	DefaultTouchPadVersion = 1
+)
+
+// 仮想指の配置と接触の既定値
+const (
+	DefaultFingerSpacing = 20 // 指同士の間隔
+	DefaultTouchMajor    = 50 // タッチ領域の長径
+	DefaultPressure      = 30 // タッチ圧力
+)
+
+// 各バックエンドの既定値
+const (
+	DefaultDetentSize      = 600  // ホイール1ノッチに相当する移動量
+	DefaultSwipeDistance   = 1500 // スワイプの方向を確定する移動量
+	DefaultKeystrokeStep   = 300  // キー入力1回に相当する移動量
+	DefaultTabletGain      = 1.0  // 仮想タブレット上の移動量の倍率
+	DefaultPrecisionScale  = 0.3  // 精密ポインター操作の移動量の倍率
+	DefaultStrokeThreshold = 0.8  // 図形として認識する一致度の下限
+	DefaultStrokeDistance  = 1500 // 図形として認識する最小の移動量
+)
+
+// 長押し認識の既定値
+const (
+	DefaultHoldDuration = 500 * time.Millisecond // 長押しと判定するまでの時間
+	DefaultHoldDeadZone = 300                    // 動かしていないとみなす移動量
+)
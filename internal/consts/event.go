@@ -2,13 +2,20 @@ package consts
 
 // イベントタイプの定数（input-event-codes.hより）
 const (
-	Syn      = 0x00 // 同期イベント
-	Key      = 0x01 // キーイベント
-	Rel      = 0x02 // 相対座標イベント
-	Abs      = 0x03 // 絶対座標イベント
-	RelX     = 0x0  // X軸の相対移動
-	RelY     = 0x1  // Y軸の相対移動
-	RelWheel = 0x8  // ホイールの相対移動
+	Syn            = 0x00 // 同期イベント
+	Key            = 0x01 // キーイベント
+	Rel            = 0x02 // 相対座標イベント
+	Abs            = 0x03 // 絶対座標イベント
+	Led            = 0x11 // LEDイベント
+	Rep            = 0x14 // キーリピート設定イベント
+	RelX           = 0x0  // X軸の相対移動
+	RelY           = 0x1  // Y軸の相対移動
+	RelHWheel      = 0x6  // 水平ホイールの相対移動
+	RelWheel       = 0x8  // ホイールの相対移動
+	RelWheelHiRes  = 0xb  // 高解像度ホイールの相対移動
+	RelHWheelHiRes = 0xc  // 高解像度水平ホイールの相対移動
+
+	WheelHiResPerDetent = 120 // ホイール1ノッチあたりの高解像度の値
 
 	AbsX            = 0x00 // X軸の絶対座標
 	AbsY            = 0x01 // Y軸の絶対座標
@@ -19,9 +26,21 @@ const (
 	AbsMtTrackingId = 0x39 // タッチ追跡用ID
 	AbsMtPressure   = 0x3a // タッチ圧力
 
-	SynReport     = 0     // イベント報告の同期
-	MouseBtnLeft  = 0x110 // マウス左ボタン
-	MouseBtnRight = 0x111 // マウス右ボタン
-	BtnTouch      = 0x14a // タッチイベント
-	BtnToolFinger = 0x145 // 指によるタッチ
+	SynReport      = 0     // イベント報告の同期
+	SynDropped     = 3     // バッファあふれによるイベントの欠落
+	RepDelay       = 0x00  // キーリピートが始まるまでの遅延(ms)
+	RepPeriod      = 0x01  // キーリピートの間隔(ms)
+	LedMax         = 0x0f  // LEDコードの最大値
+	MouseBtnLeft   = 0x110 // マウス左ボタン
+	MouseBtnRight  = 0x111 // マウス右ボタン
+	MouseBtnMiddle = 0x112 // マウス中ボタン
+	MouseBtnSide   = 0x113 // マウスサイドボタン
+	MouseBtnExtra  = 0x114 // マウス追加ボタン
+	MouseBtnFwd    = 0x115 // マウス進むボタン
+	MouseBtnBack   = 0x116 // マウス戻るボタン
+	MouseBtnTask   = 0x117 // マウスタスクボタン
+	BtnTouch       = 0x14a // タッチイベント
+	BtnToolFinger  = 0x145 // 指によるタッチ
+	BtnToolPen     = 0x140 // ペンの近接
+	BtnStylus      = 0x14b // ペンのサイドボタン
 )
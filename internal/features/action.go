@@ -0,0 +1,137 @@
+package features
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/utils"
+)
+
+// GestureInfo は認識したジェスチャーの詳細を表す
+type GestureInfo struct {
+	Direction string        // ジェスチャーの方向
+	Shape     string        // 認識した図形のテンプレート名
+	Fingers   int           // バインディングの指の本数
+	Distance  float64       // ジェスチャーの移動量
+	Duration  time.Duration // ジェスチャーにかかった時間
+}
+
+// environ はコマンドに渡す環境変数の一覧を返す
+// ジェスチャーの情報はコマンドラインに埋め込まず、環境変数としてのみ渡す
+func (g GestureInfo) environ() []string {
+	return []string{
+		"KEYBALL_GESTURE_DIRECTION=" + g.Direction,
+		"KEYBALL_GESTURE_SHAPE=" + g.Shape,
+		"KEYBALL_GESTURE_FINGERS=" + strconv.Itoa(g.Fingers),
+		"KEYBALL_GESTURE_DISTANCE=" + strconv.FormatFloat(g.Distance, 'f', 0, 64),
+		"KEYBALL_GESTURE_DURATION_MS=" + strconv.FormatInt(g.Duration.Milliseconds(), 10),
+	}
+}
+
+// 動作の種類
+const (
+	ActionKeys    = "keys"    // 仮想キーボードからキーの組み合わせを送信する
+	ActionCommand = "command" // コマンドを実行する
+	ActionIPC     = "ipc"     // i3/sway の IPC でコマンドを送信する
+)
+
+// Action はジェスチャーを認識したときに実行する動作を表す
+type Action struct {
+	Kind    string   // 動作の種類。空の場合は何もしない
+	Keys    string   // 送信するキーの組み合わせ（例: "SUPER+LEFT"）
+	Command []string // 実行するコマンドと引数
+	IPC     string   // i3/sway に送信するコマンド
+}
+
+// ジェスチャーを認識したときの動作を実行するインターフェース
+type ActionExecutor interface {
+	Execute(action Action, info GestureInfo) error
+	io.Closer
+}
+
+// ActionOptions は動作の実行に関する全体設定
+type ActionOptions struct {
+	CommandTimeout        time.Duration // コマンドの実行時間の上限
+	MaxConcurrentCommands int           // 同時に実行できるコマンドの数
+	IPCSocket             string        // i3/sway の IPC ソケット。空の場合は $SWAYSOCK, $I3SOCK を使用する
+}
+
+type actionExecutor struct {
+	keys      func() (KeyEmitter, error)
+	options   func() ActionOptions
+	commands  *CommandRunner
+	ipcSocket string // ipc が接続するソケット
+	ipc       *I3Client
+}
+
+// 動作の実行器を作成する
+// 仮想キーボードはキー入力の動作が初めて実行されるときに keys から取得する
+// options は動作を実行するたびに呼び出すため、設定の変更は次の動作から反映される
+func NewActionExecutor(keys func() (KeyEmitter, error), options func() ActionOptions) ActionExecutor {
+	opts := options()
+	return &actionExecutor{
+		keys:     keys,
+		options:  options,
+		commands: NewCommandRunner(opts.MaxConcurrentCommands, opts.CommandTimeout),
+	}
+}
+
+func (e *actionExecutor) Execute(action Action, info GestureInfo) error {
+	opts := e.options()
+	switch action.Kind {
+	case "":
+		return nil
+
+	case ActionKeys:
+		codes, err := utils.ParseKeyCombo(action.Keys)
+		if err != nil {
+			return err
+		}
+		keys, err := e.keys()
+		if err != nil {
+			return err
+		}
+		log.Printf("キー入力を送信します: %s", action.Keys)
+		return keys.Tap(codes)
+
+	case ActionCommand:
+		e.commands.SetLimits(opts.MaxConcurrentCommands, opts.CommandTimeout)
+		return e.commands.Start(action.Command, info.environ())
+
+	case ActionIPC:
+		path := opts.IPCSocket
+		if path == "" {
+			var err error
+			if path, err = I3SocketPath(); err != nil {
+				return err
+			}
+		}
+		// ソケットが変更された場合は接続し直す
+		// 送信中のコマンドを待たないよう、古い接続は別のゴルーチンで閉じる
+		if e.ipc != nil && e.ipcSocket != path {
+			go e.ipc.Close()
+			e.ipc = nil
+		}
+		if e.ipc == nil {
+			e.ipc = NewI3Client(path)
+			e.ipcSocket = path
+		}
+		// 応答を待つとジェスチャーの処理が止まるため、送信は IPC クライアントのゴルーチンで行う
+		log.Printf("IPCコマンドを送信します: %s", action.IPC)
+		return e.ipc.Send(action.IPC)
+
+	default:
+		return fmt.Errorf("不明な動作の種類です: %s", action.Kind)
+	}
+}
+
+// 仮想キーボードは所有者が閉じるため、IPCの接続のみを閉じる
+func (e *actionExecutor) Close() error {
+	if e.ipc != nil {
+		return e.ipc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package features
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CommandRunner はジェスチャーに割り当てられたコマンドを実行する
+// 実行時間と同時実行数を制限し、標準出力と標準エラー出力はログに書き出す
+type CommandRunner struct {
+	mu            sync.Mutex
+	timeout       time.Duration
+	maxConcurrent int
+	running       int // 実行中のコマンドの数
+}
+
+// 新しいコマンド実行器を作成する
+func NewCommandRunner(maxConcurrent int, timeout time.Duration) *CommandRunner {
+	return &CommandRunner{
+		timeout:       timeout,
+		maxConcurrent: maxConcurrent,
+	}
+}
+
+// SetLimits は実行時間と同時実行数の上限を変更する
+// 実行中のコマンドには影響せず、次に開始するコマンドから適用する
+func (r *CommandRunner) SetLimits(maxConcurrent int, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxConcurrent = maxConcurrent
+	r.timeout = timeout
+}
+
+// Start はコマンドをバックグラウンドで開始する
+// argv はシェルを経由せずにそのまま実行され、env は環境変数として追加される
+// 同時実行数の上限に達している場合はコマンドを実行せずにエラーを返す
+func (r *CommandRunner) Start(argv []string, env []string) error {
+	if len(argv) == 0 {
+		return fmt.Errorf("コマンドが指定されていません")
+	}
+
+	r.mu.Lock()
+	if r.running >= r.maxConcurrent {
+		r.mu.Unlock()
+		return fmt.Errorf("コマンドの同時実行数が上限(%d)に達しています: %s", r.maxConcurrent, argv[0])
+	}
+	r.running++
+	timeout := r.timeout
+	r.mu.Unlock()
+
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			r.running--
+			r.mu.Unlock()
+		}()
+		if err := runCommand(argv, env, timeout); err != nil {
+			log.Printf("コマンドの実行に失敗しました: %s: %v", argv[0], err)
+		}
+	}()
+	return nil
+}
+
+// runCommand はコマンドを実行し、終了するまで待つ
+func runCommand(argv []string, env []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	// タイムアウト時に子プロセスもまとめて終了させるため、プロセスグループを分ける
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(argv[0])
+	log.Printf("コマンドを実行します: %q", argv)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{}, 2)
+	go logOutput(name, "stdout", stdout, done)
+	go logOutput(name, "stderr", stderr, done)
+	<-done
+	<-done
+
+	err = cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("タイムアウト(%v)しました", timeout)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("コマンドが終了しました: %s", name)
+	return nil
+}
+
+// logOutput はコマンドの出力を1行ずつログに書き出す
+func logOutput(name string, stream string, r io.Reader, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Printf("[%s %s] %s", name, stream, scanner.Text())
+	}
+}
@@ -0,0 +1,38 @@
+package features
+
+import "math"
+
+// DeadZone はキーを押してからの移動量を蓄積し、一定の半径を超えたかを判定する
+// 半径の内側の小さな揺れは、操作の意図が決まるまで無視するために使う
+type DeadZone struct {
+	radius float64
+	x, y   float64
+}
+
+// 半径を指定して不感帯を作成する
+func NewDeadZone(radius float64) *DeadZone {
+	return &DeadZone{radius: radius}
+}
+
+// 蓄積した移動量を破棄する
+func (d *DeadZone) Reset() {
+	d.x = 0
+	d.y = 0
+}
+
+// 移動量を追加し、半径を超えた場合は true を返す
+func (d *DeadZone) Feed(dx int32, dy int32) bool {
+	d.x += float64(dx)
+	d.y += float64(dy)
+	return d.Distance() >= d.radius
+}
+
+// 蓄積した移動量を返す
+func (d *DeadZone) Offset() (x float64, y float64) {
+	return d.x, d.y
+}
+
+// 蓄積した移動量の大きさを返す
+func (d *DeadZone) Distance() float64 {
+	return math.Hypot(d.x, d.y)
+}
@@ -1,22 +1,42 @@
 package features
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// Device は検出した入力デバイスを表す
 type Device struct {
-	Name string
-	Path string
-	Type DeviceType
+	Name    string     // カーネルが通知するデバイス名
+	Path    string     // イベントノード (/dev/input/eventN)
+	Type    DeviceType // 通知する機能から判定した種類
+	Phys    string     // 接続先の物理的な位置（例: usb-0000:00:14.0-2/input0）
+	Uniq    string     // シリアル番号などの固有の識別子。Bluetooth デバイスではアドレス
+	Vendor  uint16     // ベンダーID
+	Product uint16     // 製品ID
+}
+
+// key はデバイス一覧で使うキーを返す
+// 複合デバイスは同じパスでキーボードとマウスの両方として検出されるため、種類も含める
+func (d Device) key() string {
+	return fmt.Sprintf("%s#%d", d.Path, d.Type)
+}
+
+// identity は再接続でパスが変わっても同じデバイスとみなすための識別子を返す
+// uniq を持たない同じ製品は同じ識別子になるため、パスの変更とみなす前に古いパスが残っていないか確かめること
+func (d Device) identity() string {
+	return fmt.Sprintf("%s#%s#%d", d.Name, d.Uniq, d.Type)
 }
 
 // デバイスタイプを表す列挙型
@@ -47,16 +67,16 @@ type DeviceEvent struct {
 type DeviceCallback func(event DeviceEvent)
 
 // DeviceMonitor はデバイスの接続状態を監視する構造体
+// カーネルの uevent で接続と切断を受け取り、netlink を使えない環境では /dev/input の変更を監視する
 type DeviceMonitor struct {
-	watcher         *fsnotify.Watcher
-	callbacks       []DeviceCallback
-	devices         map[string]*Device // パスをキーにしたデバイスマップ
-	devicesByName   map[string]*Device // 名前をキーにしたデバイスマップ
-	mutex           sync.RWMutex
-	stopChan        chan struct{}
-	autoRescanTimer *time.Timer
-	pollingTicker   *time.Ticker
-	isRunning       bool
+	source    ueventSource      // uevent の受信元。nil の場合は fsnotify で監視する
+	watcher   *fsnotify.Watcher // uevent を使えない場合の監視
+	sysfsRoot string
+	callbacks []DeviceCallback
+	devices   map[string]*Device // key() をキーにしたデバイスマップ
+	mutex     sync.RWMutex
+	stopChan  chan struct{}
+	isRunning bool
 }
 
 // グローバルなDeviceMonitorインスタンス
@@ -69,39 +89,7 @@ var (
 // ScanDevices は基本的なデバイス検出を行い、現在接続されているデバイスリストを返します
 // デバイスモニターを使用せず直接検出を行うため、キャッシュの影響を受けません
 func ScanDevices() ([]Device, error) {
-	entries, err := os.ReadDir("/dev/input/by-id")
-	if err != nil {
-		return nil, err
-	}
-	var devices []Device
-	for _, entry := range entries {
-		// eventが含まれない場合はスキップ
-		if !strings.Contains(entry.Name(), "event") {
-			continue
-		}
-		fullPath := "/dev/input/by-id/" + entry.Name()
-		realPath, err := os.Readlink(fullPath)
-		if err != nil {
-			continue
-		}
-
-		// 絶対パスを構築
-		absPath := ""
-		if strings.HasPrefix(realPath, "/") {
-			absPath = realPath
-		} else {
-			absPath = "/dev/input/" + filepath.Base(realPath)
-		}
-
-		if strings.Contains(entry.Name(), "kbd") {
-			devices = append(devices, Device{Name: entry.Name(), Path: absPath, Type: DeviceTypeKeyboard})
-		}
-		if strings.Contains(entry.Name(), "mouse") {
-			devices = append(devices, Device{Name: entry.Name(), Path: absPath, Type: DeviceTypeMouse})
-		}
-	}
-
-	return devices, nil
+	return ScanDevicesAt(DefaultSysfsRoot)
 }
 
 // 基本的なデバイス検出用の関数 (デバイスモニターを使用しない)
@@ -112,12 +100,6 @@ func scanDevices() ([]Device, error) {
 
 // 現在接続されているデバイスを取得する関数
 func GetDevices() ([]Device, error) {
-	// 再帰を防ぐためのフラグ
-	static := false
-	if static {
-		return scanDevices()
-	}
-
 	// デバイスモニターが利用可能かチェック (ただし初期化はしない)
 	deviceMonitorMutex.Lock()
 	monitor := globalDeviceMonitor
@@ -143,15 +125,8 @@ func RescanDevices() ([]Device, error) {
 	deviceMonitorMutex.Unlock()
 
 	if monitor != nil {
-		// 強制的に再スキャン
-		devices, err := scanDevices()
-		if err != nil {
-			return nil, err
-		}
-
-		// モニターのデバイスリストを更新
-		monitor.updateDeviceList(devices)
-		return devices, nil
+		// 強制的に再スキャンし、モニターのデバイスリストを更新
+		return monitor.rescan()
 	}
 
 	// モニターがなければ単に検出
@@ -159,20 +134,29 @@ func RescanDevices() ([]Device, error) {
 }
 
 // NewDeviceMonitor は新しいDeviceMonitorを作成する
+// uevent のソケットは Start で開く
 func NewDeviceMonitor() (*DeviceMonitor, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, err
-	}
-
 	return &DeviceMonitor{
-		watcher:   watcher,
+		sysfsRoot: DefaultSysfsRoot,
 		callbacks: make([]DeviceCallback, 0),
 		devices:   make(map[string]*Device),
 		stopChan:  make(chan struct{}),
 	}, nil
 }
 
+// NewDeviceMonitorFromUevents は r から読み込んだ uevent の列で動作するモニターを作成する
+// デバイスは sysfsRoot 以下から読み込む。偽の sysfs と組み合わせた動作確認に使う
+// r の形式は readerUeventSource を参照
+func NewDeviceMonitorFromUevents(r io.Reader, sysfsRoot string) *DeviceMonitor {
+	return &DeviceMonitor{
+		source:    newReaderUeventSource(r),
+		sysfsRoot: sysfsRoot,
+		callbacks: make([]DeviceCallback, 0),
+		devices:   make(map[string]*Device),
+		stopChan:  make(chan struct{}),
+	}
+}
+
 // Start はデバイスの監視を開始する
 func (dm *DeviceMonitor) Start() error {
 	if dm.isRunning {
@@ -181,27 +165,26 @@ func (dm *DeviceMonitor) Start() error {
 
 	log.Println("デバイスモニターを開始します")
 	dm.isRunning = true
-	dm.devicesByName = make(map[string]*Device)
 
-	// 監視対象のディレクトリを追加
-	dirs := []string{
-		"/dev/input",
-		"/dev/input/by-id",
-		"/dev/input/by-path",
+	// 初期スキャンとの間の接続を取りこぼさないよう、スキャンより先に監視を始める
+	if dm.source == nil {
+		source, err := openNetlinkUevents()
+		if err != nil {
+			log.Printf("uevent を利用できないため、ファイルシステムを監視します: %v", err)
+		} else {
+			dm.source = source
+			log.Println("uevent の監視を開始します")
+		}
 	}
-
-	for _, dir := range dirs {
-		if _, err := os.Stat(dir); !os.IsNotExist(err) {
-			if err := dm.watcher.Add(dir); err != nil {
-				log.Printf("ディレクトリの監視に失敗しました: %s - %v", dir, err)
-			} else {
-				log.Printf("ディレクトリ監視を開始: %s", dir)
-			}
+	if dm.source == nil {
+		if err := dm.startWatcher(); err != nil {
+			dm.isRunning = false
+			return err
 		}
 	}
 
 	// 初期デバイス一覧を取得
-	devices, err := ScanDevices()
+	devices, err := ScanDevicesAt(dm.sysfsRoot)
 	if err != nil {
 		log.Printf("初期デバイス一覧の取得に失敗しました: %v", err)
 	} else {
@@ -210,15 +193,27 @@ func (dm *DeviceMonitor) Start() error {
 	}
 
 	// イベント監視ゴルーチンを起動
-	go dm.watchEvents()
-
-	// 定期的なリスキャンタイマーを設定（5秒ごと）
-	dm.autoRescanTimer = time.AfterFunc(5*time.Second, dm.periodicRescan)
+	if dm.source != nil {
+		go dm.watchUevents()
+	} else {
+		go dm.watchEvents()
+	}
 
-	// デバイスのポーリング監視を開始（2秒ごと）
-	dm.pollingTicker = time.NewTicker(2 * time.Second)
-	go dm.runPolling()
+	return nil
+}
 
+// startWatcher は uevent の代わりに /dev/input の変更を監視する
+func (dm *DeviceMonitor) startWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("ファイルシステムの監視を開始できませんでした: %w", err)
+	}
+	if err := watcher.Add("/dev/input"); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("ディレクトリの監視に失敗しました: /dev/input - %w", err)
+	}
+	log.Printf("ディレクトリ監視を開始: /dev/input")
+	dm.watcher = watcher
 	return nil
 }
 
@@ -233,19 +228,14 @@ func (dm *DeviceMonitor) Stop() {
 	// 停止シグナルを送信
 	close(dm.stopChan)
 
-	// タイマーを停止
-	if dm.autoRescanTimer != nil {
-		dm.autoRescanTimer.Stop()
+	// 受信元を閉じて待機中の読み込みを終わらせる
+	if dm.source != nil {
+		_ = dm.source.Close()
 	}
-
-	// ポーリングタイマーを停止
-	if dm.pollingTicker != nil {
-		dm.pollingTicker.Stop()
+	if dm.watcher != nil {
+		_ = dm.watcher.Close()
 	}
 
-	// ウォッチャーを閉じる
-	dm.watcher.Close()
-
 	dm.isRunning = false
 }
 
@@ -257,215 +247,181 @@ func (dm *DeviceMonitor) RegisterCallback(callback DeviceCallback) {
 	dm.callbacks = append(dm.callbacks, callback)
 }
 
-// periodicRescan は定期的にデバイス一覧を再スキャンする
-func (dm *DeviceMonitor) periodicRescan() {
-	// デバイス一覧を再スキャン
-	dm.RescanDevices()
-
-	// タイマーを再設定（5秒後に再度実行）
-	if dm.isRunning {
-		dm.autoRescanTimer.Reset(5 * time.Second)
-	}
-}
-
 // RescanDevices はデバイス一覧を強制的に再スキャンする
 func (dm *DeviceMonitor) RescanDevices() {
-	devices, err := RescanDevices()
-	if err != nil {
+	if _, err := dm.rescan(); err != nil {
 		log.Printf("デバイス再スキャンに失敗しました: %v", err)
-		return
 	}
+}
 
+// rescan はデバイス一覧を再スキャンしてモニターに反映し、検出したデバイスを返す
+func (dm *DeviceMonitor) rescan() ([]Device, error) {
+	devices, err := ScanDevicesAt(dm.sysfsRoot)
+	if err != nil {
+		return nil, err
+	}
 	dm.updateDeviceList(devices)
+	return devices, nil
 }
 
-// runPolling はデバイスの存在を定期的に確認する
-func (dm *DeviceMonitor) runPolling() {
-	log.Println("デバイスポーリング監視を開始します")
-
+// watchUevents は uevent を受け取り、入力デバイスの接続と切断を反映する
+func (dm *DeviceMonitor) watchUevents() {
 	for {
-		select {
-		case <-dm.stopChan:
-			log.Println("デバイスポーリング監視を停止します")
+		event, err := dm.source.next()
+		if err != nil {
+			select {
+			case <-dm.stopChan:
+				log.Println("uevent の監視を停止します")
+				return
+			default:
+			}
+			if errors.Is(err, syscall.ENOBUFS) {
+				// 受信バッファがあふれてイベントを取りこぼしたため、一覧を作り直す
+				log.Println("uevent を取りこぼしたため、デバイスを再スキャンします")
+				dm.RescanDevices()
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				log.Println("uevent の入力が終了しました")
+			} else {
+				log.Printf("uevent の受信に失敗しました: %v", err)
+			}
 			return
-		case <-dm.pollingTicker.C:
-			// デバイスの存在チェックと新規デバイス検出を実行
-			dm.checkDeviceExistence()
 		}
+		dm.handleUevent(event)
 	}
 }
 
-// checkDeviceExistence は現在登録されているデバイスの存在確認と新規デバイスの検出を行う
-func (dm *DeviceMonitor) checkDeviceExistence() {
-	// デバイス一覧を取得
-	newDevices, err := ScanDevices()
-	if err != nil {
-		log.Printf("デバイススキャンに失敗しました: %v", err)
+// handleUevent はイベントノード (input/eventN) の uevent をデバイス一覧に反映する
+func (dm *DeviceMonitor) handleUevent(event Uevent) {
+	if event.Subsystem != "input" || !strings.HasPrefix(event.DevName, "input/event") {
 		return
 	}
+	path := filepath.Join("/dev", event.DevName)
+	log.Printf("uevent: %s %s (seq=%d)", event.Action, path, event.Seqnum)
 
-	// デバイス名をキーにしたマップを作成
-	newDeviceMap := make(map[string]Device)
-	for _, dev := range newDevices {
-		newDeviceMap[dev.Name] = dev
-	}
-
-	// 現在のデバイス一覧を取得
-	dm.mutex.RLock()
-	currentDevices := make(map[string]bool)
-	nameToPaths := make(map[string]string)
-
-	for path, device := range dm.devices {
-		currentDevices[path] = true
-		nameToPaths[device.Name] = path
-	}
-	dm.mutex.RUnlock()
-
-	// 削除されたデバイスを検出
-	var removedPaths []string
-	for path := range currentDevices {
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			removedPaths = append(removedPaths, path)
-		}
-	}
-
-	// 新しく見つかったデバイスを検出
-	var newDeviceList []Device
-	for _, dev := range newDevices {
-		if _, exists := nameToPaths[dev.Name]; !exists {
-			newDeviceList = append(newDeviceList, dev)
-		}
-	}
-
-	// 削除されたデバイスがあれば通知
-	if len(removedPaths) > 0 {
-		log.Printf("ポーリングで削除されたデバイスを検出: %d 個", len(removedPaths))
-		for _, path := range removedPaths {
-			dm.mutex.Lock()
-			if device, exists := dm.devices[path]; exists {
-				log.Printf("デバイスが削除されました: %s (%s)", device.Name, path)
-				dm.notifyCallbacks(DeviceEvent{
-					Type:   DeviceRemoved,
-					Device: device,
-					Path:   path,
-				})
-				delete(dm.devices, path)
-				delete(dm.devicesByName, device.Name)
-			}
-			dm.mutex.Unlock()
+	switch event.Action {
+	case "add", "change":
+		devices, err := readSysfsDevice(filepath.Join(dm.sysfsRoot, event.DevPath), ownVirtualDevices())
+		if err != nil {
+			log.Printf("デバイス情報を読み込めませんでした: %s - %v", path, err)
+			return
 		}
+		dm.updateDevicesAt(path, devices)
+	case "remove":
+		dm.updateDevicesAt(path, nil)
 	}
+}
 
-	// 新しいデバイスがあれば追加
-	if len(newDeviceList) > 0 {
-		log.Printf("ポーリングで新しいデバイスを検出: %d 個", len(newDeviceList))
-		dm.updateDeviceList(newDeviceList)
-	}
-
-	// 既存のデバイスでパスが変更されたものがないか確認
+// updateDevicesAt は1つのイベントノードで検出したデバイスを反映する
+// devices に含まれない種類は切断されたものとして扱う
+func (dm *DeviceMonitor) updateDevicesAt(path string, devices []Device) {
 	dm.mutex.Lock()
-	defer dm.mutex.Unlock()
-
-	for name, newDevice := range newDeviceMap {
-		if oldDevice, exists := dm.devicesByName[name]; exists {
-			// パスが変更された場合
-			if oldDevice.Path != newDevice.Path {
-				log.Printf("デバイスパスが変更されました: %s: %s → %s",
-					name, oldDevice.Path, newDevice.Path)
-
-				// 古いパスエントリを削除
-				delete(dm.devices, oldDevice.Path)
-
-				// 新しいパスで更新
-				deviceCopy := newDevice
-				dm.devices[newDevice.Path] = &deviceCopy
-				dm.devicesByName[name] = &deviceCopy
-
-				// パス変更を通知
-				dm.notifyCallbacks(DeviceEvent{
-					Type:   DeviceChanged,
-					Device: &deviceCopy,
-					Path:   newDevice.Path,
-				})
-			}
+	var events []DeviceEvent
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		seen[device.key()] = true
+		events = dm.putDevice(device, events)
+	}
+	for key, device := range dm.devices {
+		if device.Path == path && !seen[key] {
+			events = dm.removeDevice(key, events)
 		}
 	}
+	dm.mutex.Unlock()
+
+	dm.notifyAll(events)
 }
 
 // updateDeviceList は現在のデバイス一覧を更新し、変更があれば通知する
+// newDevices は接続されているすべてのデバイスで、含まれないデバイスは切断されたものとして扱う
 func (dm *DeviceMonitor) updateDeviceList(newDevices []Device) {
 	dm.mutex.Lock()
-	defer dm.mutex.Unlock()
-
-	// デバイスマップがまだ初期化されていない場合は初期化
-	if dm.devices == nil {
-		dm.devices = make(map[string]*Device)
+	var events []DeviceEvent
+	seen := make(map[string]bool)
+	for _, device := range newDevices {
+		seen[device.key()] = true
+		events = dm.putDevice(device, events)
+	}
+	for key := range dm.devices {
+		if !seen[key] {
+			events = dm.removeDevice(key, events)
+		}
 	}
+	dm.mutex.Unlock()
 
-	if dm.devicesByName == nil {
-		dm.devicesByName = make(map[string]*Device)
-	}
+	dm.notifyAll(events)
+}
 
-	// 現在のデバイスマップをコピー
-	currentDevices := make(map[string]bool)
-	for path := range dm.devices {
-		currentDevices[path] = true
+// putDevice はデバイスを登録し、変更があれば通知するイベントを events に追加して返す
+// 呼び出し側で mutex をロックしておくこと
+// 同じ内容で登録済みの場合は追加しないため、同じ接続を何度受け取っても通知は1回になる
+// 別のデバイスに置き換わった場合やパスが変わった場合は、切断と接続として通知する
+func (dm *DeviceMonitor) putDevice(device Device, events []DeviceEvent) []DeviceEvent {
+	key := device.key()
+	if old, exists := dm.devices[key]; exists {
+		if *old == device {
+			return events
+		}
+		if old.identity() == device.identity() {
+			// 同じデバイスの phys などの情報だけが変わった
+			log.Printf("デバイス情報が変更: %s (%s)", device.Name, device.Path)
+			dm.devices[key] = &device
+			return append(events, DeviceEvent{Type: DeviceChanged, Device: &device, Path: device.Path})
+		}
+		// 切断を受け取る前に、同じイベントノードが別のデバイスに割り当てられた
+		log.Printf("デバイスが置き換わりました: %s → %s (%s)", old.Name, device.Name, device.Path)
+		events = dm.removeDevice(key, events)
 	}
 
-	// 新しいデバイス情報を整理
-	deviceNames := make(map[string]bool)
-
-	// 新しいデバイスを確認
-	for i := range newDevices {
-		device := &newDevices[i]
-		path := device.Path
-		deviceNames[device.Name] = true
+	if old := dm.movedDevice(device); old != nil {
+		// 切断を受け取る前に、同じデバイスが別のイベントノードで再接続された
+		// 古いパスを開いている利用者が再接続できるよう、切断を先に通知する
+		log.Printf("デバイスパスが変更されました: %s: %s → %s", device.Name, old.Path, device.Path)
+		events = dm.removeDevice(old.key(), events)
+	}
 
-		// 新規デバイスの場合
-		if _, exists := dm.devices[path]; !exists {
-			dm.devices[path] = device
-			dm.devicesByName[device.Name] = device
+	log.Printf("新しいデバイスを追加: %s (%s)", device.Name, device.Path)
+	dm.devices[key] = &device
+	return append(events, DeviceEvent{Type: DeviceAdded, Device: &device, Path: device.Path})
+}
 
-			log.Printf("新しいデバイスを追加: %s (%s)", device.Name, path)
-			dm.notifyCallbacks(DeviceEvent{
-				Type:   DeviceAdded,
-				Device: device,
-				Path:   path,
-			})
-		} else {
-			// 既存のデバイス（変更があるかチェック）
-			if dm.devices[path].Name != device.Name {
-				log.Printf("デバイス情報が変更: %s → %s (%s)",
-					dm.devices[path].Name, device.Name, path)
-
-				dm.devices[path] = device
-				dm.devicesByName[device.Name] = device
-
-				dm.notifyCallbacks(DeviceEvent{
-					Type:   DeviceChanged,
-					Device: device,
-					Path:   path,
-				})
-			}
-			// 既知のデバイスとしてマーク
-			delete(currentDevices, path)
+// movedDevice は device が別のイベントノードから再接続されたものであれば、古いパスのデバイスを返す
+// uniq がある場合は同じ識別子のデバイスを同じものとみなす。ない場合は同じ製品を2台つないだだけのこともあるため、
+// 古いイベントノードが sysfs から消えているときだけ再接続とみなす
+// 呼び出し側で mutex をロックしておくこと
+func (dm *DeviceMonitor) movedDevice(device Device) *Device {
+	for _, old := range dm.devices {
+		if old.Path == device.Path || old.identity() != device.identity() {
+			continue
+		}
+		if old.Uniq != "" {
+			return old
+		}
+		_, err := os.Lstat(filepath.Join(dm.sysfsRoot, "class", "input", filepath.Base(old.Path)))
+		if errors.Is(err, os.ErrNotExist) {
+			return old
 		}
 	}
+	return nil
+}
 
-	// 削除されたデバイスを確認
-	for path := range currentDevices {
-		device := dm.devices[path]
-		// デバイス名が別のパスで再登録されていないことを確認
-		if !deviceNames[device.Name] {
-			log.Printf("デバイスを削除: %s (%s)", device.Name, path)
-			dm.notifyCallbacks(DeviceEvent{
-				Type:   DeviceRemoved,
-				Device: device,
-				Path:   path,
-			})
-			delete(dm.devices, path)
-			delete(dm.devicesByName, device.Name)
-		}
+// removeDevice はデバイスを削除し、通知するイベントを events に追加して返す
+// 呼び出し側で mutex をロックしておくこと
+func (dm *DeviceMonitor) removeDevice(key string, events []DeviceEvent) []DeviceEvent {
+	device, exists := dm.devices[key]
+	if !exists {
+		return events
+	}
+	log.Printf("デバイスを削除: %s (%s)", device.Name, device.Path)
+	delete(dm.devices, key)
+	return append(events, DeviceEvent{Type: DeviceRemoved, Device: device, Path: device.Path})
+}
+
+// notifyAll はイベントを順にコールバックへ通知する。mutex をロックせずに呼び出すこと
+func (dm *DeviceMonitor) notifyAll(events []DeviceEvent) {
+	for _, event := range events {
+		dm.notifyCallbacks(event)
 	}
 }
 
@@ -497,25 +453,26 @@ func (dm *DeviceMonitor) notifyCallbacks(event DeviceEvent) {
 }
 
 // watchEvents はfsnotifyのイベントを監視する
+// uevent を使えない環境での代わりで、イベントノードの作成と削除をまとめて再スキャンする
 func (dm *DeviceMonitor) watchEvents() {
 	log.Println("ファイルシステムイベント監視を開始します")
 
 	// デバイスのデバッグ情報を表示
 	debugDevices := func() {
-		devicePaths := make([]string, 0, len(dm.devices))
 		dm.mutex.RLock()
 		defer dm.mutex.RUnlock()
+		devicePaths := make([]string, 0, len(dm.devices))
 
-		for path := range dm.devices {
-			devicePaths = append(devicePaths, path)
+		for key := range dm.devices {
+			devicePaths = append(devicePaths, key)
 		}
 
 		// パスを並べ替えて表示
 		sort.Strings(devicePaths)
 		log.Println("現在監視中のデバイス一覧:")
-		for _, path := range devicePaths {
-			dev := dm.devices[path]
-			log.Printf("  - パス: %s, 名前: %s, タイプ: %v", path, dev.Name, dev.Type)
+		for _, key := range devicePaths {
+			dev := dm.devices[key]
+			log.Printf("  - パス: %s, 名前: %s, タイプ: %v", dev.Path, dev.Name, dev.Type)
 		}
 	}
 
@@ -547,16 +504,10 @@ func (dm *DeviceMonitor) watchEvents() {
 				return
 			}
 
-			// 特定のデバイス関連イベントのみログ出力
-			isDeviceEvent := strings.Contains(event.Name, "/dev/input")
-			if isDeviceEvent {
+			// イベントノードの作成と削除のみ処理
+			isDeviceEvent := strings.HasPrefix(filepath.Base(event.Name), "event")
+			if isDeviceEvent && event.Op&(fsnotify.Create|fsnotify.Remove) != 0 {
 				log.Printf("ファイルシステムイベント: %s %s", event.Op.String(), event.Name)
-			}
-
-			// デバイスに関連するイベントのみ処理
-			if isDeviceEvent && (event.Op&fsnotify.Create == fsnotify.Create ||
-				event.Op&fsnotify.Remove == fsnotify.Remove ||
-				event.Op&fsnotify.Write == fsnotify.Write) {
 
 				// タイマーをリセットして複数のイベントをバッチ処理
 				if !pendingRescan {
@@ -585,6 +536,13 @@ func (dm *DeviceMonitor) GetConnectedDevices() []Device {
 		devices = append(devices, *device)
 	}
 
+	// スキャンと同じくイベントノードの番号順に並べる
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Path != devices[j].Path {
+			return eventNumber(devices[i].Path) < eventNumber(devices[j].Path)
+		}
+		return devices[i].Type < devices[j].Type
+	})
 	return devices
 }
 
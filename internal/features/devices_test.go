@@ -0,0 +1,204 @@
+package features
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+)
+
+// removeFakeInputDevice は入力デバイスを偽の sysfs から取り除く
+func removeFakeInputDevice(t *testing.T, root string, d fakeInputDevice) {
+	t.Helper()
+	if err := os.Remove(filepath.Join(root, "class", "input", d.event)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "devices", d.devPath)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 通知を待つ最大時間と、通知がないことを確かめるために待つ時間
+const (
+	deviceEventTimeout = time.Second
+	deviceEventQuiet   = 50 * time.Millisecond
+)
+
+// ueventFeeder は DeviceMonitor に uevent を1件ずつ渡し、通知されたイベントを受け取る
+type ueventFeeder struct {
+	t      *testing.T
+	w      *io.PipeWriter
+	events chan DeviceEvent
+}
+
+// startFakeMonitor は偽の sysfs と uevent の列で動作するモニターを開始する
+func startFakeMonitor(t *testing.T, root string) *ueventFeeder {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(root, "class", "input"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	r, w := io.Pipe()
+	f := &ueventFeeder{t: t, w: w, events: make(chan DeviceEvent, 16)}
+
+	dm := NewDeviceMonitorFromUevents(r, root)
+	dm.RegisterCallback(func(event DeviceEvent) { f.events <- event })
+	if err := dm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = w.Close()
+		dm.Stop()
+	})
+	return f
+}
+
+// send は uevent を1件書き込み、モニターが処理し終えるまで待つ
+//
+// パイプへの書き込みは読み取られるまで戻らない。モニターは1件のイベントを処理し終えてから次を読むため、
+// 続けて空行を書き込めば、その書き込みが戻った時点で直前のイベントの処理が終わっている
+func (f *ueventFeeder) send(action string, d fakeInputDevice) {
+	f.t.Helper()
+	event := fmt.Sprintf("ACTION=%s\nDEVPATH=/devices/%s/%s\nSUBSYSTEM=input\nDEVNAME=input/%s\n\n",
+		action, d.devPath, d.event, d.event)
+	for _, s := range []string{event, "\n"} {
+		if _, err := io.WriteString(f.w, s); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+// expect は通知を受け取り、種類とパスの組を確認する
+// コールバックはそれぞれ別のゴルーチンで呼ばれるため、順番は問わない
+func (f *ueventFeeder) expect(want ...DeviceEvent) {
+	f.t.Helper()
+	var got []string
+	for range want {
+		select {
+		case event := <-f.events:
+			got = append(got, fmt.Sprintf("%d %s", event.Type, event.Path))
+		case <-time.After(deviceEventTimeout):
+			f.t.Fatalf("通知が届きません: got %v, want %d 件", got, len(want))
+		}
+	}
+	var wantKeys []string
+	for _, event := range want {
+		wantKeys = append(wantKeys, fmt.Sprintf("%d %s", event.Type, event.Path))
+	}
+	slices.Sort(got)
+	slices.Sort(wantKeys)
+	if !slices.Equal(got, wantKeys) {
+		f.t.Fatalf("通知が違います:\n got %v\nwant %v", got, wantKeys)
+	}
+}
+
+// expectNone はこれ以上通知されないことを確認する
+func (f *ueventFeeder) expectNone() {
+	f.t.Helper()
+	select {
+	case event := <-f.events:
+		f.t.Fatalf("想定外の通知です: %d %s", event.Type, event.Path)
+	case <-time.After(deviceEventQuiet):
+	}
+}
+
+func TestDeviceMonitorFromUevents(t *testing.T) {
+	root := t.TempDir()
+	f := startFakeMonitor(t, root)
+
+	// 同じ接続を2回受け取っても通知は1回
+	addFakeInputDevice(t, root, fakeBluetoothMouse)
+	f.send("add", fakeBluetoothMouse)
+	f.send("add", fakeBluetoothMouse)
+	f.expect(DeviceEvent{Type: DeviceAdded, Path: "/dev/input/event7"})
+	f.expectNone()
+
+	removeFakeInputDevice(t, root, fakeBluetoothMouse)
+	f.send("remove", fakeBluetoothMouse)
+	f.expect(DeviceEvent{Type: DeviceRemoved, Path: "/dev/input/event7"})
+
+	// 別のインスタンスが作成した仮想デバイスは通知しない
+	addFakeInputDevice(t, root, fakeOwnPointer)
+	f.send("add", fakeOwnPointer)
+	f.expectNone()
+}
+
+func TestDeviceMonitorPathChange(t *testing.T) {
+	root := t.TempDir()
+	f := startFakeMonitor(t, root)
+
+	addFakeInputDevice(t, root, fakeBluetoothMouse)
+	f.send("add", fakeBluetoothMouse)
+	f.expect(DeviceEvent{Type: DeviceAdded, Path: "/dev/input/event7"})
+
+	// 切断を受け取る前に、同じデバイスが別のイベントノードで再接続された
+	moved := fakeBluetoothMouse
+	moved.event = "event8"
+	moved.devPath = "virtual/misc/uhid/0005:046D:B023.0005/input/input13"
+	addFakeInputDevice(t, root, moved)
+	f.send("add", moved)
+	f.expect(
+		DeviceEvent{Type: DeviceRemoved, Path: "/dev/input/event7"},
+		DeviceEvent{Type: DeviceAdded, Path: "/dev/input/event8"},
+	)
+
+	// 遅れて届いた古いパスの切断は通知しない
+	removeFakeInputDevice(t, root, fakeBluetoothMouse)
+	f.send("remove", fakeBluetoothMouse)
+	f.expectNone()
+}
+
+func TestDeviceMonitorSameNameDevices(t *testing.T) {
+	root := t.TempDir()
+	f := startFakeMonitor(t, root)
+
+	// uniq を持たない同じ製品のマウスを2台つなぐ
+	first := fakeInputDevice{
+		event:   "event5",
+		devPath: "pci0000:00/0000:00:14.0/usb1/1-4/1-4:1.0/input/input8",
+		name:    "USB Optical Mouse",
+		phys:    "usb-0000:00:14.0-4/input0",
+		vendor:  0x046d,
+		product: 0xc077,
+		ev:      []int{consts.Syn, consts.Key, consts.Rel},
+		key:     fakeMouseButtons,
+		rel:     []int{consts.RelX, consts.RelY},
+	}
+	second := first
+	second.event = "event6"
+	second.devPath = "pci0000:00/0000:00:14.0/usb1/1-5/1-5:1.0/input/input9"
+	second.phys = "usb-0000:00:14.0-5/input0"
+
+	addFakeInputDevice(t, root, first)
+	f.send("add", first)
+	f.expect(DeviceEvent{Type: DeviceAdded, Path: "/dev/input/event5"})
+
+	// 1台目は接続されたままなので、2台目をパスの変更とみなさない
+	addFakeInputDevice(t, root, second)
+	f.send("add", second)
+	f.expect(DeviceEvent{Type: DeviceAdded, Path: "/dev/input/event6"})
+	f.expectNone()
+
+	// 再スキャンしても切断と接続を繰り返さない
+	f.send("change", first)
+	f.send("change", second)
+	f.expectNone()
+
+	// 1台目を抜いて別のポートにつなぎ直した場合は、古いノードが消えているので再接続とみなす
+	removeFakeInputDevice(t, root, first)
+	moved := first
+	moved.event = "event10"
+	moved.devPath = "pci0000:00/0000:00:14.0/usb1/1-6/1-6:1.0/input/input14"
+	moved.phys = "usb-0000:00:14.0-6/input0"
+	addFakeInputDevice(t, root, moved)
+	f.send("add", moved)
+	f.expect(
+		DeviceEvent{Type: DeviceRemoved, Path: "/dev/input/event5"},
+		DeviceEvent{Type: DeviceAdded, Path: "/dev/input/event10"},
+	)
+	f.expectNone()
+}
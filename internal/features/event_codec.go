@@ -0,0 +1,72 @@
+package features
+
+import (
+	"encoding/binary"
+
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// eventLayout は struct input_event のバイト配置を表す
+//
+// struct input_event は時刻(struct timeval 相当)、type(u16)、code(u16)、value(s32) の順に並ぶ。
+// 時刻の秒とマイクロ秒はカーネルの long の幅で、アーキテクチャによって配置が変わる:
+//
+//	64ビット環境: sec(8) usec(8) type(2) code(2) value(4) = 24バイト
+//	32ビット環境: sec(4) usec(4) type(2) code(2) value(4) = 16バイト
+//
+// 32ビット環境で time_t を64ビットにした環境(time64)でも、カーネルとのやり取りは16バイトのままで、
+// 秒は符号なし32ビットとして扱われる。バイト順は実行環境のものに従う。
+type eventLayout struct {
+	timeSize int // 時刻の部分のバイト数
+}
+
+var (
+	eventLayout64 = eventLayout{timeSize: 16} // 64ビット環境の配置
+	eventLayout32 = eventLayout{timeSize: 8}  // 32ビット環境の配置（time64 を含む）
+)
+
+// size はイベント1件のバイト数を返す
+func (l eventLayout) size() int {
+	return l.timeSize + 8
+}
+
+// append はイベントをバイト列の末尾に追加する
+func (l eventLayout) append(buf []byte, ev types.Event) []byte {
+	if l.timeSize == 16 {
+		buf = binary.NativeEndian.AppendUint64(buf, uint64(ev.Time.Sec))
+		buf = binary.NativeEndian.AppendUint64(buf, uint64(ev.Time.Usec))
+	} else {
+		buf = binary.NativeEndian.AppendUint32(buf, uint32(ev.Time.Sec))
+		buf = binary.NativeEndian.AppendUint32(buf, uint32(ev.Time.Usec))
+	}
+	buf = binary.NativeEndian.AppendUint16(buf, ev.Type)
+	buf = binary.NativeEndian.AppendUint16(buf, ev.Code)
+	return binary.NativeEndian.AppendUint32(buf, uint32(ev.Value))
+}
+
+// decode はバイト列の先頭のイベントを読み取る。buf は size() バイト以上なければならない
+func (l eventLayout) decode(buf []byte) types.Event {
+	var e types.Event
+	if l.timeSize == 16 {
+		e.Time.Sec = int64(binary.NativeEndian.Uint64(buf[0:8]))
+		e.Time.Usec = int64(binary.NativeEndian.Uint64(buf[8:16]))
+	} else {
+		e.Time.Sec = int64(binary.NativeEndian.Uint32(buf[0:4]))
+		e.Time.Usec = int64(binary.NativeEndian.Uint32(buf[4:8]))
+	}
+	rest := buf[l.timeSize:]
+	e.Type = binary.NativeEndian.Uint16(rest[0:2])
+	e.Code = binary.NativeEndian.Uint16(rest[2:4])
+	e.Value = int32(binary.NativeEndian.Uint32(rest[4:8]))
+	return e
+}
+
+// イベントを実行環境の配置でバイト列の末尾に追加する
+func appendEvent(buf []byte, ev types.Event) []byte {
+	return nativeEventLayout.append(buf, ev)
+}
+
+// 読み取ったバイト列を実行環境の配置でイベントに変換する
+func decodeEvent(buf []byte) types.Event {
+	return nativeEventLayout.decode(buf)
+}
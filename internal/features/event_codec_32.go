@@ -0,0 +1,9 @@
+//go:build 386 || arm || mips || mipsle
+
+package features
+
+// input_event 1件のバイト数（32ビット環境。time64 の環境も同じ）
+const eventSize = 16
+
+// 実行環境の struct input_event の配置
+var nativeEventLayout = eventLayout32
@@ -0,0 +1,9 @@
+//go:build amd64 || arm64 || loong64 || mips64 || mips64le || ppc64 || ppc64le || riscv64 || s390x
+
+package features
+
+// input_event 1件のバイト数（64ビット環境）
+const eventSize = 24
+
+// 実行環境の struct input_event の配置
+var nativeEventLayout = eventLayout64
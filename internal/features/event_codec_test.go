@@ -0,0 +1,148 @@
+package features
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// 期待値はリトルエンディアンで書き、ビッグエンディアンの環境では各フィールドを反転して使う
+var (
+	fields64 = []int{8, 8, 2, 2, 4} // sec usec type code value
+	fields32 = []int{4, 4, 2, 2, 4}
+)
+
+var eventCodecCases = []struct {
+	name   string
+	layout eventLayout
+	fields []int
+	event  types.Event
+	golden []byte // リトルエンディアンでのバイト列
+}{
+	{
+		name:   "64ビット環境",
+		layout: eventLayout64,
+		fields: fields64,
+		event: types.Event{
+			Time:  types.EventTime{Sec: 1700000000, Usec: 123456},
+			Type:  consts.Rel,
+			Code:  consts.RelX,
+			Value: -5,
+		},
+		golden: []byte{
+			0x00, 0xf1, 0x53, 0x65, 0x00, 0x00, 0x00, 0x00, // sec
+			0x40, 0xe2, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, // usec
+			0x02, 0x00, // type
+			0x00, 0x00, // code
+			0xfb, 0xff, 0xff, 0xff, // value
+		},
+	},
+	{
+		name:   "32ビット環境",
+		layout: eventLayout32,
+		fields: fields32,
+		event: types.Event{
+			Time:  types.EventTime{Sec: 1700000000, Usec: 123456},
+			Type:  consts.Rel,
+			Code:  consts.RelX,
+			Value: -5,
+		},
+		golden: []byte{
+			0x00, 0xf1, 0x53, 0x65, // sec
+			0x40, 0xe2, 0x01, 0x00, // usec
+			0x02, 0x00, // type
+			0x00, 0x00, // code
+			0xfb, 0xff, 0xff, 0xff, // value
+		},
+	},
+	{
+		// 2038年以降の時刻は秒を符号なし32ビットとして扱う
+		name:   "32ビット環境(time64)",
+		layout: eventLayout32,
+		fields: fields32,
+		event: types.Event{
+			Time:  types.EventTime{Sec: 0x90000000, Usec: 999999},
+			Type:  consts.Abs,
+			Code:  consts.AbsMtPositionX,
+			Value: -1,
+		},
+		golden: []byte{
+			0x00, 0x00, 0x00, 0x90, // sec
+			0x3f, 0x42, 0x0f, 0x00, // usec
+			0x03, 0x00, // type
+			0x35, 0x00, // code
+			0xff, 0xff, 0xff, 0xff, // value
+		},
+	},
+}
+
+// nativeGolden はリトルエンディアンの期待値を実行環境のバイト順に変換する
+func nativeGolden(golden []byte, fields []int) []byte {
+	out := slices.Clone(golden)
+	if binary.NativeEndian.Uint16([]byte{1, 0}) == 1 {
+		return out
+	}
+	off := 0
+	for _, n := range fields {
+		slices.Reverse(out[off : off+n])
+		off += n
+	}
+	return out
+}
+
+func TestEventLayoutAppend(t *testing.T) {
+	for _, tc := range eventCodecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			want := nativeGolden(tc.golden, tc.fields)
+			if len(want) != tc.layout.size() {
+				t.Fatalf("期待値の長さが size() と違います: %d != %d", len(want), tc.layout.size())
+			}
+
+			// 既存のバイト列の末尾に追加されることも確認する
+			prefix := []byte{0xaa, 0xbb}
+			got := tc.layout.append(slices.Clone(prefix), tc.event)
+			if !bytes.Equal(got[:len(prefix)], prefix) {
+				t.Fatalf("既存のバイト列が書き換えられました: % x", got[:len(prefix)])
+			}
+			if !bytes.Equal(got[len(prefix):], want) {
+				t.Fatalf("エンコード結果が違います:\n got % x\nwant % x", got[len(prefix):], want)
+			}
+		})
+	}
+}
+
+func TestEventLayoutDecode(t *testing.T) {
+	for _, tc := range eventCodecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.layout.decode(nativeGolden(tc.golden, tc.fields))
+			if got != tc.event {
+				t.Fatalf("デコード結果が違います:\n got %+v\nwant %+v", got, tc.event)
+			}
+		})
+	}
+}
+
+func TestEventLayoutRoundTrip(t *testing.T) {
+	for _, tc := range eventCodecCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := tc.layout.append(nil, tc.event)
+			if got := tc.layout.decode(buf); got != tc.event {
+				t.Fatalf("往復した結果が違います:\n got %+v\nwant %+v", got, tc.event)
+			}
+		})
+	}
+}
+
+func TestNativeEventLayout(t *testing.T) {
+	if nativeEventLayout.size() != eventSize {
+		t.Fatalf("実行環境の配置の大きさが eventSize と違います: %d != %d", nativeEventLayout.size(), eventSize)
+	}
+	ev := types.Event{Type: consts.Rel, Code: consts.RelX, Value: -120}
+	if got := decodeEvent(appendEvent(nil, ev)); got != ev {
+		t.Fatalf("往復した結果が違います: got %+v, want %+v", got, ev)
+	}
+}
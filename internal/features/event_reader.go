@@ -0,0 +1,35 @@
+package features
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// readWithTimeout は読み取れるイベントが届くまで最大 timeout だけ待って読み取る
+// 時間内に届かなかった場合は 0 を返す
+func readWithTimeout(file *os.File, buf []byte, timeout time.Duration) (int, error) {
+	fd := int(file.Fd())
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	ready, err := unix.Poll(fds, int(timeout/time.Millisecond))
+	if err != nil {
+		if err == unix.EINTR {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if ready == 0 {
+		return 0, nil
+	}
+	if fds[0].Revents&unix.POLLIN == 0 {
+		return 0, fmt.Errorf("デバイスが切断されました")
+	}
+
+	n, err := unix.Read(fd, buf)
+	if err == unix.EAGAIN {
+		return 0, nil
+	}
+	return n, err
+}
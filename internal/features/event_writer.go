@@ -0,0 +1,64 @@
+package features
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// 1フレームとして想定するイベント数。超えた場合はバッファを拡張して使い続ける
+const eventWriterCapacity = 32
+
+// eventWriter は1フレーム分のイベントをまとめて1回の write(2) で送信する
+// エンコード用のバッファを使い回すため、送信のたびにメモリを確保しない
+// 複数のゴルーチンから使われるデバイスもあるため、書き込みは直列化する
+type eventWriter struct {
+	file   *os.File
+	device *virtualDevice // 送信数を集計する仮想デバイス。仮想デバイス以外へ書き込む場合は nil
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// デバイスファイルに書き込むエンコーダーを作成する
+func newEventWriter(file *os.File) *eventWriter {
+	return &eventWriter{
+		file:   file,
+		device: virtualDevices.lookup(file),
+		buf:    make([]byte, 0, eventSize*eventWriterCapacity),
+	}
+}
+
+// write はイベントをエンコードし、1回の書き込みで送信する
+func (w *eventWriter) write(events []types.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = w.buf[:0]
+	for _, ev := range events {
+		w.buf = appendEvent(w.buf, ev)
+	}
+	n, err := w.file.Write(w.buf)
+	if w.device != nil {
+		w.device.count(len(events), err)
+	}
+	if err != nil {
+		return fmt.Errorf("イベントの書き込みに失敗しました: %v", err)
+	}
+	if n != len(w.buf) {
+		return fmt.Errorf("イベントの書き込みが途中で終わりました: %d/%d バイト", n, len(w.buf))
+	}
+	return nil
+}
+
+// イベントを書き込む
+// 頻繁に送信するデバイスでは eventWriter を使い回すこと
+func writeEvents(deviceFile *os.File, events []types.Event) error {
+	return newEventWriter(deviceFile).write(events)
+}
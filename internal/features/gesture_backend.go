@@ -0,0 +1,94 @@
+package features
+
+import (
+	"io"
+	"time"
+)
+
+// Motion はジェスチャー中のトラックボールの移動量を表す
+type Motion struct {
+	DX, DY       int32     // フィルターと倍率を適用した移動量
+	RawDX, RawDY int32     // デバイスから読み取ったままの移動量
+	Time         time.Time // 移動量を読み取った時刻
+}
+
+// Arrangement は仮想指の並べ方を表す
+type Arrangement int
+
+const (
+	ArrangeColumn Arrangement = iota // 縦一列
+	ArrangeRow                       // 横一列
+	ArrangeArc                       // 手のひらのような弧状
+)
+
+// Gesture はバックエンドを開始するときに渡すジェスチャーの設定
+// 各バックエンドは自分に関係する項目だけを使う
+type Gesture struct {
+	Fingers        int           // 仮想指の本数
+	Pointer        bool          // 1本の仮想指によるポインター操作
+	Layout         FingerLayout  // 仮想指の置き方
+	ResetThreshold time.Duration // この時間動かさなければ指を置き直す
+	MotionFilter   *MotionFilter // 指を置き直すときにリセットする移動量のフィルター
+
+	Wheel          WheelOptions
+	Swipe          SwipeOptions
+	Keystroke      KeystrokeOptions
+	Stroke         StrokeOptions
+	TabletGain     float64 // 仮想タブレットの移動量の倍率
+	PrecisionScale float64 // 精密ポインター操作の移動量の倍率
+	Replay         string  // 再生する記録の名前
+}
+
+// FingerLayout は仮想タッチパッドに置く指の配置を表す
+type FingerLayout struct {
+	AnchorX, AnchorY int32       // 指を置き始める座標
+	Arrangement      Arrangement // 指の並べ方
+	Spacing          int32       // 指の間隔
+	TouchMajor       int32       // タッチ領域の主軸
+	Pressure         int32       // タッチ圧力
+}
+
+// WheelOptions はホイール出力の設定
+type WheelOptions struct {
+	DetentSize int32 // ホイール1ノッチに相当する移動量
+	Invert     bool  // スクロール方向を反転する
+}
+
+// SwipeOptions はスワイプ認識の設定
+type SwipeOptions struct {
+	Distance float64                        // 方向を確定する移動量
+	Velocity float64                        // 方向を確定する最低速度（移動量/秒）
+	Actions  map[SwipeDirection]SwipeAction // 方向ごとの動作
+}
+
+// SwipeAction はスワイプの方向ごとの動作
+type SwipeAction struct {
+	Action
+	Repeat bool // 閾値の移動量ごとに繰り返し実行する
+}
+
+// KeystrokeOptions は移動量をキー入力の繰り返しに変換する設定
+type KeystrokeOptions struct {
+	Step                  float64 // キー入力1回に相当する移動量
+	MaxRate               float64 // 1秒あたりの最大キー入力回数。0の場合は制限しない
+	Up, Down, Left, Right string  // 方向ごとに送信するキーの組み合わせ
+}
+
+// StrokeOptions は図形認識の設定
+type StrokeOptions struct {
+	Threshold   float64           // 認識する一致度の下限 (0-1)
+	MinDistance float64           // 認識する最小の移動量
+	Actions     map[string]Action // テンプレート名ごとの動作
+}
+
+// ジェスチャーの出力先を表すインターフェース
+// サービスはトリガーキーが押されている間、Begin, Move, End の順に呼び出す
+type GestureBackend interface {
+	// ジェスチャーを開始する
+	Begin(g Gesture) error
+	// 移動量を出力する。移動がない場合も定期的に呼び出される
+	Move(m Motion) error
+	// ジェスチャーを終了する
+	End() error
+	io.Closer
+}
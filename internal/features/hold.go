@@ -0,0 +1,55 @@
+package features
+
+import "time"
+
+// HoldState は長押し認識の状態を表す
+type HoldState int
+
+const (
+	HoldPending HoldState = iota // まだ判定できない
+	HoldFired                    // 動かさずに一定時間押し続けた
+	HoldMoved                    // 不感帯を超えて動かした
+)
+
+// HoldRecognizer はトリガーキーを押したままトラックボールをほとんど動かさない操作を認識する
+// 不感帯はスワイプ認識と同じ DeadZone で判定する
+type HoldRecognizer struct {
+	deadZone *DeadZone
+	duration time.Duration
+	start    time.Time
+}
+
+// 長押しと判定するまでの時間と不感帯の半径を指定して認識器を作成する
+func NewHoldRecognizer(duration time.Duration, deadZone float64) *HoldRecognizer {
+	return &HoldRecognizer{
+		deadZone: NewDeadZone(deadZone),
+		duration: duration,
+	}
+}
+
+// 押し始めた時刻を設定し、蓄積した移動量を破棄する
+func (r *HoldRecognizer) Reset(now time.Time) {
+	r.deadZone.Reset()
+	r.start = now
+}
+
+// 移動量を追加して現在の状態を返す
+func (r *HoldRecognizer) Feed(dx int32, dy int32, now time.Time) HoldState {
+	if r.deadZone.Feed(dx, dy) {
+		return HoldMoved
+	}
+	if now.Sub(r.start) >= r.duration {
+		return HoldFired
+	}
+	return HoldPending
+}
+
+// 不感帯の中で蓄積した移動量を返す
+func (r *HoldRecognizer) Offset() (x float64, y float64) {
+	return r.deadZone.Offset()
+}
+
+// 押し始めてからの時間を返す
+func (r *HoldRecognizer) Elapsed(now time.Time) time.Duration {
+	return now.Sub(r.start)
+}
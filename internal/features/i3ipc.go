@@ -0,0 +1,208 @@
+package features
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// i3 IPC プロトコルの定数
+const (
+	i3IPCMagic      = "i3-ipc"
+	i3IPCRunCommand = 0 // RUN_COMMAND メッセージ
+	i3IPCHeaderSize = len(i3IPCMagic) + 8
+	i3IPCTimeout    = 2 * time.Second
+	i3IPCQueueSize  = 16 // 送信待ちにできるコマンドの数
+)
+
+// I3Client は i3/sway の IPC ソケットにコマンドを送信する
+// 接続は最初のコマンド送信時に確立し、切断された場合は次の送信時に再接続する
+type I3Client struct {
+	socketPath string
+	conn       net.Conn
+	mutex      sync.Mutex // conn を保護し、コマンドを1つずつ送信する
+	closed     atomic.Bool
+
+	queueMutex sync.Mutex // queue を保護する
+	queue      chan string
+}
+
+// I3SocketPath は環境変数から i3/sway の IPC ソケットのパスを取得する
+// $SWAYSOCK を優先し、なければ $I3SOCK を使用する
+func I3SocketPath() (string, error) {
+	for _, env := range []string{"SWAYSOCK", "I3SOCK"} {
+		if path := os.Getenv(env); path != "" {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("IPCソケットが見つかりません ($SWAYSOCK, $I3SOCK が未設定です)")
+}
+
+// 指定したソケットに接続する IPC クライアントを作成する
+func NewI3Client(socketPath string) *I3Client {
+	return &I3Client{socketPath: socketPath}
+}
+
+// Send はコマンドを送信待ちに追加してすぐに戻る
+// 送信は専用のゴルーチンが追加した順に行い、失敗した場合はログに出力する
+func (c *I3Client) Send(command string) error {
+	c.queueMutex.Lock()
+	defer c.queueMutex.Unlock()
+	if c.closed.Load() {
+		return fmt.Errorf("IPCクライアントは閉じられています")
+	}
+	if c.queue == nil {
+		c.queue = make(chan string, i3IPCQueueSize)
+		go c.sendLoop(c.queue)
+	}
+	select {
+	case c.queue <- command:
+		return nil
+	default:
+		return fmt.Errorf("IPCコマンドの送信待ちが上限(%d)に達しています: %s", i3IPCQueueSize, command)
+	}
+}
+
+func (c *I3Client) sendLoop(queue <-chan string) {
+	for command := range queue {
+		if err := c.RunCommand(command); err != nil {
+			log.Printf("IPCコマンドの送信に失敗しました: %v", err)
+		}
+	}
+}
+
+// RunCommand はコマンド（例: "workspace next"）を送信し、実行結果を確認する
+// 接続または書き込みに失敗した場合のみ、一度だけ再接続して再送する
+// 書き込み後に応答を読めなかった場合は、コマンドが実行された可能性があるため再送しない
+func (c *I3Client) RunCommand(command string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed.Load() {
+		return fmt.Errorf("IPCクライアントは閉じられています")
+	}
+
+	reply, sent, err := c.request(i3IPCRunCommand, []byte(command))
+	if err != nil && !sent {
+		log.Printf("IPCの送信に失敗したため再接続します: %v", err)
+		c.closeConn()
+		reply, _, err = c.request(i3IPCRunCommand, []byte(command))
+	}
+	if err != nil {
+		c.closeConn()
+		return err
+	}
+
+	var results []struct {
+		Success bool   `json:"success"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(reply, &results); err != nil {
+		return fmt.Errorf("IPCの応答を解析できませんでした: %w", err)
+	}
+	var failures []string
+	for _, r := range results {
+		if !r.Success {
+			failures = append(failures, r.Error)
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("コマンドが失敗しました: %s: %s", command, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Close は接続を閉じる。送信待ちのコマンドは破棄する
+func (c *I3Client) Close() error {
+	c.queueMutex.Lock()
+	if !c.closed.Swap(true) && c.queue != nil {
+		close(c.queue)
+	}
+	c.queueMutex.Unlock()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closeConn()
+	return nil
+}
+
+// request はメッセージを送信し、同じ種類の応答を待つ
+// sent はメッセージを最後まで書き込めたかどうかを表す
+func (c *I3Client) request(msgType uint32, payload []byte) (reply []byte, sent bool, err error) {
+	if c.conn == nil {
+		conn, err := net.DialTimeout("unix", c.socketPath, i3IPCTimeout)
+		if err != nil {
+			return nil, false, fmt.Errorf("IPCソケットに接続できません: %w", err)
+		}
+		c.conn = conn
+	}
+
+	if err := c.conn.SetDeadline(time.Now().Add(i3IPCTimeout)); err != nil {
+		return nil, false, err
+	}
+	if err := writeI3Message(c.conn, msgType, payload); err != nil {
+		return nil, false, err
+	}
+
+	for {
+		replyType, reply, err := readI3Message(c.conn)
+		if err != nil {
+			return nil, true, fmt.Errorf("IPCの応答を読み取れませんでした: %w", err)
+		}
+		// 最上位ビットが立っているものは購読したイベントなので読み飛ばす
+		if replyType&(1<<31) != 0 {
+			continue
+		}
+		if replyType != msgType {
+			return nil, true, fmt.Errorf("想定外の応答です: type=%d", replyType)
+		}
+		return reply, true, nil
+	}
+}
+
+func (c *I3Client) closeConn() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// writeI3Message は i3 IPC の形式 ("i3-ipc" + 長さ + 種類 + 本文) でメッセージを書き込む
+// 長さと種類はネイティブのバイトオーダーで表す
+func writeI3Message(w io.Writer, msgType uint32, payload []byte) error {
+	buf := make([]byte, i3IPCHeaderSize+len(payload))
+	copy(buf, i3IPCMagic)
+	binary.NativeEndian.PutUint32(buf[len(i3IPCMagic):], uint32(len(payload)))
+	binary.NativeEndian.PutUint32(buf[len(i3IPCMagic)+4:], msgType)
+	copy(buf[i3IPCHeaderSize:], payload)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// readI3Message は i3 IPC の形式のメッセージを1つ読み取る
+func readI3Message(r io.Reader) (msgType uint32, payload []byte, err error) {
+	header := make([]byte, i3IPCHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	if !bytes.Equal(header[:len(i3IPCMagic)], []byte(i3IPCMagic)) {
+		return 0, nil, fmt.Errorf("IPCメッセージのマジックが不正です: %q", header[:len(i3IPCMagic)])
+	}
+
+	length := binary.NativeEndian.Uint32(header[len(i3IPCMagic):])
+	msgType = binary.NativeEndian.Uint32(header[len(i3IPCMagic)+4:])
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return msgType, payload, nil
+}
@@ -0,0 +1,181 @@
+package features
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeI3Server は i3 IPC の RUN_COMMAND を受け付けるテスト用のサーバー
+type fakeI3Server struct {
+	t        *testing.T
+	listener net.Listener
+	received atomic.Int32 // 受け取ったコマンドの数
+	commands chan string
+}
+
+// startFakeI3Server はサーバーを起動する
+// handle は接続ごとに呼ばれ、受け取ったコマンドに応答するかどうかと、応答後に接続を閉じるかどうかを返す
+func startFakeI3Server(t *testing.T, handle func(conn int, command string) (reply, hangUp bool)) *fakeI3Server {
+	t.Helper()
+	listener, err := net.Listen("unix", t.TempDir()+"/sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeI3Server{t: t, listener: listener, commands: make(chan string, 16)}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for n := 0; ; n++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(n, conn, handle)
+		}
+	}()
+	return s
+}
+
+func (s *fakeI3Server) serve(n int, conn net.Conn, handle func(int, string) (bool, bool)) {
+	defer conn.Close()
+	for {
+		msgType, payload, err := readI3Message(conn)
+		if err != nil {
+			return
+		}
+		if msgType != i3IPCRunCommand {
+			s.t.Errorf("メッセージの種類が違います: %d", msgType)
+			return
+		}
+		s.received.Add(1)
+		s.commands <- string(payload)
+
+		reply, hangUp := handle(n, string(payload))
+		if reply {
+			if err := writeI3Message(conn, i3IPCRunCommand, []byte(`[{"success":true}]`)); err != nil {
+				return
+			}
+		}
+		if hangUp {
+			return
+		}
+	}
+}
+
+func (s *fakeI3Server) path() string {
+	return s.listener.Addr().String()
+}
+
+func TestI3MessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeI3Message(&buf, i3IPCRunCommand, []byte("workspace next")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte("i3-ipc")
+	want = binary.NativeEndian.AppendUint32(want, uint32(len("workspace next")))
+	want = binary.NativeEndian.AppendUint32(want, i3IPCRunCommand)
+	want = append(want, "workspace next"...)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("書き込んだメッセージが違います:\n got %q\nwant %q", buf.Bytes(), want)
+	}
+
+	msgType, payload, err := readI3Message(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgType != i3IPCRunCommand || string(payload) != "workspace next" {
+		t.Fatalf("読み取ったメッセージが違います: type=%d payload=%q", msgType, payload)
+	}
+}
+
+func TestI3ClientRunCommand(t *testing.T) {
+	server := startFakeI3Server(t, func(int, string) (bool, bool) { return true, false })
+	client := NewI3Client(server.path())
+	defer client.Close()
+
+	for _, command := range []string{"workspace next", "workspace prev"} {
+		if err := client.RunCommand(command); err != nil {
+			t.Fatalf("RunCommand(%q): %v", command, err)
+		}
+		if got := <-server.commands; got != command {
+			t.Fatalf("サーバーが受け取ったコマンドが違います: got %q, want %q", got, command)
+		}
+	}
+}
+
+func TestI3ClientReconnectsAfterHangUp(t *testing.T) {
+	// 最初の接続は応答後に閉じ、次の送信では書き込みに失敗させる
+	closed := make(chan struct{})
+	server := startFakeI3Server(t, func(conn int, _ string) (bool, bool) {
+		if conn == 0 {
+			defer close(closed)
+			return true, true
+		}
+		return true, false
+	})
+	client := NewI3Client(server.path())
+	defer client.Close()
+
+	if err := client.RunCommand("workspace 1"); err != nil {
+		t.Fatal(err)
+	}
+	<-closed
+	// サーバーが接続を閉じ終わるのを待つ
+	time.Sleep(50 * time.Millisecond)
+
+	if err := client.RunCommand("workspace 2"); err != nil {
+		t.Fatalf("再接続して送信できませんでした: %v", err)
+	}
+	if got := server.received.Load(); got != 2 {
+		t.Fatalf("サーバーが受け取ったコマンドの数が違います: got %d, want 2", got)
+	}
+}
+
+func TestI3ClientDoesNotResendAfterReadFailure(t *testing.T) {
+	// コマンドを受け取ったあと、応答せずに接続を閉じる
+	server := startFakeI3Server(t, func(int, string) (bool, bool) { return false, true })
+	client := NewI3Client(server.path())
+	defer client.Close()
+
+	if err := client.RunCommand("exec foot"); err == nil {
+		t.Fatal("応答がないのにエラーになりませんでした")
+	}
+	// 再送されていれば2件目が届く
+	time.Sleep(50 * time.Millisecond)
+	if got := server.received.Load(); got != 1 {
+		t.Fatalf("コマンドが再送されました: received=%d", got)
+	}
+}
+
+func TestI3ClientSend(t *testing.T) {
+	server := startFakeI3Server(t, func(int, string) (bool, bool) { return true, false })
+	client := NewI3Client(server.path())
+	defer client.Close()
+
+	commands := []string{"workspace 1", "workspace 2", "workspace 3"}
+	for _, command := range commands {
+		if err := client.Send(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range commands {
+		select {
+		case got := <-server.commands:
+			if got != want {
+				t.Fatalf("送信の順番が違います: got %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("コマンドが届きませんでした: %q", want)
+		}
+	}
+
+	_ = client.Close()
+	if err := client.Send("workspace 4"); err == nil {
+		t.Fatal("閉じたクライアントで送信できました")
+	}
+}
@@ -0,0 +1,165 @@
+package features
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+)
+
+// 注入するジェスチャーの移動の緩急
+const (
+	EasingLinear    = "linear"
+	EasingEaseIn    = "ease-in"
+	EasingEaseOut   = "ease-out"
+	EasingEaseInOut = "ease-in-out"
+)
+
+// 注入するジェスチャーでフレームを送る間隔
+const injectFrameInterval = 8 * time.Millisecond
+
+// GestureSpec は宣言的に指定したジェスチャーを表す
+// Path を指定した場合は各点を順に通り、指定しない場合は (DX, DY) まで直線で移動する
+// 座標はいずれもジェスチャー開始位置からの相対値
+type GestureSpec struct {
+	Fingers       int        `json:"fingers"`
+	Path          [][2]int32 `json:"path,omitempty"`
+	DX            int32      `json:"dx,omitempty"`
+	DY            int32      `json:"dy,omitempty"`
+	DurationMs    int64      `json:"duration_ms"`
+	Easing        string     `json:"easing,omitempty"`
+	FingerSpacing int32      `json:"finger_spacing,omitempty"`
+}
+
+// BuildRecording は指定したジェスチャーを、タッチパッドで再生できる記録に変換する
+// 指はタッチパッドの中央付近に横一列に置き、経路全体が範囲に収まるよう開始位置をずらす
+func BuildRecording(spec GestureSpec, bounds TouchPadBounds) (TouchRecording, error) {
+	if spec.Fingers < 1 || spec.Fingers > consts.MaxFingers {
+		return TouchRecording{}, fmt.Errorf("指の本数は1-%dで指定してください: %d", consts.MaxFingers, spec.Fingers)
+	}
+	if spec.DurationMs <= 0 {
+		return TouchRecording{}, fmt.Errorf("duration_ms は正の値で指定してください: %d", spec.DurationMs)
+	}
+	ease, err := easingFunc(spec.Easing)
+	if err != nil {
+		return TouchRecording{}, err
+	}
+
+	path := spec.Path
+	if len(path) == 0 {
+		path = [][2]int32{{0, 0}, {spec.DX, spec.DY}}
+	}
+	points := make([]StrokePoint, len(path))
+	for i, p := range path {
+		points[i] = StrokePoint{float64(p[0]), float64(p[1])}
+	}
+	total := pathLength(points)
+	if total == 0 {
+		return TouchRecording{}, fmt.Errorf("移動量が指定されていません")
+	}
+
+	spacing := spec.FingerSpacing
+	if spacing <= 0 {
+		spacing = consts.DefaultFingerSpacing
+	}
+	startX, startY, err := fitStart(points, spec.Fingers, spacing, bounds)
+	if err != nil {
+		return TouchRecording{}, err
+	}
+
+	frames := []TouchFrame{{Op: TouchOpContact, TouchMajor: consts.DefaultTouchMajor, Pressure: consts.DefaultPressure}}
+	for i := 0; i < spec.Fingers; i++ {
+		frames = append(frames, TouchFrame{
+			Op:         TouchOpDown,
+			Slot:       i,
+			TrackingID: i + 1,
+			X:          startX + int32(i)*spacing,
+			Y:          startY,
+		})
+	}
+
+	duration := time.Duration(spec.DurationMs) * time.Millisecond
+	steps := max(1, int(duration/injectFrameInterval))
+	for step := 1; step <= steps; step++ {
+		t := float64(step) / float64(steps)
+		p := pointAlongPath(points, ease(t)*total)
+		at := time.Duration(float64(duration) * t).Microseconds()
+		for i := 0; i < spec.Fingers; i++ {
+			frames = append(frames, TouchFrame{
+				Time: at,
+				Op:   TouchOpMove,
+				Slot: i,
+				X:    startX + int32(i)*spacing + int32(p[0]),
+				Y:    startY + int32(p[1]),
+			})
+		}
+	}
+	for i := 0; i < spec.Fingers; i++ {
+		frames = append(frames, TouchFrame{Time: duration.Microseconds(), Op: TouchOpUp, Slot: i})
+	}
+
+	return TouchRecording{
+		Name:       "injected",
+		RecordedAt: time.Now(),
+		TouchPad:   bounds,
+		Frames:     frames,
+	}, nil
+}
+
+// fitStart は指の並びと経路がタッチパッドに収まる開始位置を返す
+// 中央から始め、はみ出す場合は内側へずらす
+func fitStart(points []StrokePoint, fingers int, spacing int32, bounds TouchPadBounds) (int32, int32, error) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		minX, maxX = min(minX, p[0]), max(maxX, p[0])
+		minY, maxY = min(minY, p[1]), max(maxY, p[1])
+	}
+	maxX += float64(spacing) * float64(fingers-1)
+
+	if maxX-minX > float64(bounds.MaxX-bounds.MinX) || maxY-minY > float64(bounds.MaxY-bounds.MinY) {
+		return 0, 0, fmt.Errorf("ジェスチャーの移動量がタッチパッドの範囲を超えています")
+	}
+
+	centerX := float64(bounds.MinX) + float64(bounds.MaxX-bounds.MinX)/2 - (minX+maxX)/2
+	centerY := float64(bounds.MinY) + float64(bounds.MaxY-bounds.MinY)/2 - (minY+maxY)/2
+	return int32(centerX), int32(centerY), nil
+}
+
+// pointAlongPath は経路の始点から distance だけ進んだ位置を返す
+func pointAlongPath(points []StrokePoint, distance float64) StrokePoint {
+	for i := 1; i < len(points); i++ {
+		d := pointDistance(points[i-1], points[i])
+		if distance <= d && d > 0 {
+			t := distance / d
+			return StrokePoint{
+				points[i-1][0] + t*(points[i][0]-points[i-1][0]),
+				points[i-1][1] + t*(points[i][1]-points[i-1][1]),
+			}
+		}
+		distance -= d
+	}
+	return points[len(points)-1]
+}
+
+// easingFunc は経過の割合 (0-1) を移動の割合 (0-1) に変換する関数を返す
+func easingFunc(name string) (func(float64) float64, error) {
+	switch name {
+	case "", EasingLinear:
+		return func(t float64) float64 { return t }, nil
+	case EasingEaseIn:
+		return func(t float64) float64 { return t * t * t }, nil
+	case EasingEaseOut:
+		return func(t float64) float64 { return 1 - math.Pow(1-t, 3) }, nil
+	case EasingEaseInOut:
+		return func(t float64) float64 {
+			if t < 0.5 {
+				return 4 * t * t * t
+			}
+			return 1 - math.Pow(-2*t+2, 3)/2
+		}, nil
+	default:
+		return nil, fmt.Errorf("不明な easing です: %s", name)
+	}
+}
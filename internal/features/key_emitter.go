@@ -0,0 +1,71 @@
+package features
+
+import (
+	"io"
+	"os"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// キー入力を送信する仮想キーボードを表現するインターフェース
+type KeyEmitter interface {
+	// キーを順に押し、逆順に離す
+	Tap(codes []int) error
+	io.Closer
+}
+
+type virtualKeyEmitter struct {
+	name       []byte
+	deviceFile *os.File
+	writer     *eventWriter
+}
+
+// 新しい仮想キーボードデバイスを作成する
+func CreateKeyEmitter(path string, name []byte) (KeyEmitter, error) {
+	// マウスボタンなどの BTN_* 範囲を除いたすべてのキーを通知する
+	// BTN_* を含めると libinput がポインターやジョイスティックとして扱うため
+	var keys []int
+	for code := 1; code < consts.BtnTriggerHappy; code++ {
+		if code >= consts.BtnMin && code < consts.KeyOk {
+			continue
+		}
+		keys = append(keys, code)
+	}
+
+	fd, err := createUinputDevice(path, uinputProfile{
+		kind: VirtualDeviceKeyboard,
+		name: name,
+		id: types.InputID{
+			Bustype: consts.BusUsb,
+			Vendor:  consts.VirtualDeviceVendor,
+			Product: 0x0819,
+			Version: 1,
+		},
+		keys: keys,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &virtualKeyEmitter{name: name, deviceFile: fd, writer: newEventWriter(fd)}, nil
+}
+
+func (ke *virtualKeyEmitter) Close() error {
+	_ = releaseDevice(ke.deviceFile)
+	return ke.deviceFile.Close()
+}
+
+func (ke *virtualKeyEmitter) Tap(codes []int) error {
+	events := make([]types.Event, 0, len(codes)*2+2)
+	for _, code := range codes {
+		events = append(events, types.Event{Type: consts.Key, Code: uint16(code), Value: 1})
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+	for i := len(codes) - 1; i >= 0; i-- {
+		events = append(events, types.Event{Type: consts.Key, Code: uint16(codes[i]), Value: 0})
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+
+	return ke.writer.write(events)
+}
@@ -12,6 +12,8 @@ import (
 // キーボードからの入力を処理するインターフェース
 type Keyboard interface {
 	GetKey() (key int32)
+	// グラブ中に送り直さず握りつぶすキーを設定する
+	SetSwallowKeys(keys []int)
 	Close() error
 }
 
@@ -40,6 +42,9 @@ func (v virtualKeyboard) GetKey() (key int32) {
 	return -1
 }
 
+// グラブしていないキーボードはすべてのキーがそのまま届くため何もしない
+func (v virtualKeyboard) SetSwallowKeys(keys []int) {}
+
 func getPressedKeys(file *os.File) ([]int, error) {
 	const (
 		keyMax    = 0x2ff
@@ -0,0 +1,370 @@
+package features
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+	"github.com/char5742/keyball-gestures/internal/utils"
+)
+
+// 読み取りを待つ間隔。Close はこの間隔で終了を確認する
+const grabPollInterval = 100 * time.Millisecond
+
+// grabbedKeyboard はキーボードをグラブし、トリガーキー以外を仮想キーボードから送り直す
+//
+// グラブはデバイスファイルを閉じるとカーネルが解除するため、
+// デーモンが異常終了した場合もキーボードが使えなくなることはない。
+// 仮想キーボードもプロセス終了時に破棄され、押下中のキーはカーネルが離す。
+type grabbedKeyboard struct {
+	virtualKeyboard
+	output    *os.File // 送り直し先の仮想キーボード
+	writer    *eventWriter
+	ledWriter *eventWriter // 元のキーボードにLEDの状態を書き戻す
+
+	mu      sync.Mutex
+	swallow map[uint16]bool // 送り直さないキー
+	pressed map[uint16]bool // 仮想キーボードで押下中のキー
+	grabbed bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// 監視するデバイスをグラブし、送り直し用の仮想キーボードを作成する
+// 仮想キーボードは元のデバイスと同じキーとLEDを通知し、キーリピートの設定も引き継ぐ
+func CreateGrabbedKeyboard(path string, uinputPath string, name []byte, swallow []int) (Keyboard, error) {
+	// LEDの状態を書き戻すため読み書き両用で開く
+	f, err := os.OpenFile(path, syscall.O_RDWR|syscall.O_NONBLOCK, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("デバイスファイルを開くのに失敗しました: %w", err)
+	}
+
+	keys, err := getSupportedCodes(f, consts.Key, consts.KeyMax)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("キーボードが通知するキーの取得に失敗しました: %w", err)
+	}
+	leds, err := getSupportedCodes(f, consts.Led, consts.LedMax)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("キーボードのLEDの取得に失敗しました: %w", err)
+	}
+
+	output, err := createUinputDevice(uinputPath, uinputProfile{
+		kind: VirtualDevicePassthroughKeyboard,
+		name: name,
+		id: types.InputID{
+			Bustype: consts.BusUsb,
+			Vendor:  consts.VirtualDeviceVendor,
+			Product: 0x081b,
+			Version: 1,
+		},
+		keys: keys,
+		leds: leds,
+		// 元のデバイスのリピートは転送せず、仮想キーボード側のカーネルに生成させる
+		rep: true,
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	k := &grabbedKeyboard{
+		virtualKeyboard: virtualKeyboard{f},
+		output:          output,
+		writer:          newEventWriter(output),
+		ledWriter:       newEventWriter(f),
+		pressed:         make(map[uint16]bool),
+		done:            make(chan struct{}),
+	}
+	k.SetSwallowKeys(swallow)
+	k.copyRepeatSettings()
+
+	k.wg.Add(2)
+	go k.forwardKeys()
+	go k.mirrorLeds()
+
+	return k, nil
+}
+
+func (k *grabbedKeyboard) SetSwallowKeys(keys []int) {
+	swallow := make(map[uint16]bool, len(keys))
+	for _, key := range keys {
+		swallow[uint16(key)] = true
+	}
+	k.mu.Lock()
+	k.swallow = swallow
+	k.mu.Unlock()
+}
+
+func (k *grabbedKeyboard) Close() error {
+	k.closeOnce.Do(func() { close(k.done) })
+	k.wg.Wait()
+
+	k.mu.Lock()
+	k.releaseGrab()
+	k.releasePressed()
+	k.mu.Unlock()
+
+	_ = releaseDevice(k.output)
+	_ = k.output.Close()
+	return k.File.Close()
+}
+
+// copyRepeatSettings は元のデバイスのキーリピートの遅延と間隔を仮想キーボードに設定する
+func (k *grabbedKeyboard) copyRepeatSettings() {
+	var rep [2]uint32
+	if err := utils.IOCtl(k.File, consts.EVIOCGREP, uintptr(unsafe.Pointer(&rep[0]))); err != nil {
+		// リピートに対応しないデバイスではカーネルの既定値を使う
+		return
+	}
+	err := k.writer.write([]types.Event{
+		{Type: consts.Rep, Code: consts.RepDelay, Value: int32(rep[0])},
+		{Type: consts.Rep, Code: consts.RepPeriod, Value: int32(rep[1])},
+		{Type: consts.Syn, Code: consts.SynReport, Value: 0},
+	})
+	if err != nil {
+		log.Printf("キーリピートの設定の引き継ぎに失敗しました: %v", err)
+	}
+}
+
+// forwardKeys はグラブしたキーボードのイベントを仮想キーボードから送り直す
+func (k *grabbedKeyboard) forwardKeys() {
+	defer k.wg.Done()
+
+	// 押されたままグラブすると、離した操作が元のデバイスの利用者に届かず押しっぱなしになる
+	if !k.waitForAllReleased() {
+		return
+	}
+
+	k.mu.Lock()
+	if err := utils.IOCtl(k.File, consts.EVIOCGRAB, 1); err != nil {
+		k.mu.Unlock()
+		log.Printf("キーボードのグラブに失敗しました: %v", err)
+		return
+	}
+	k.grabbed = true
+	k.mu.Unlock()
+	log.Println("キーボードをグラブしました")
+
+	size := eventSize
+	buf := make([]byte, size*64)
+	frame := make([]types.Event, 0, 16)
+	dropping := false
+
+	for {
+		n, err := readWithTimeout(k.File, buf, grabPollInterval)
+		if err != nil {
+			log.Printf("キーボードの読み取りを終了します: %v", err)
+			return
+		}
+		select {
+		case <-k.done:
+			return
+		default:
+		}
+
+		for off := 0; off+size <= n; off += size {
+			e := decodeEvent(buf[off : off+size])
+			switch e.Type {
+			case consts.Key:
+				if !dropping && k.shouldForward(e) {
+					frame = append(frame, types.Event{Type: e.Type, Code: e.Code, Value: e.Value})
+				}
+
+			case consts.Syn:
+				switch e.Code {
+				case consts.SynDropped:
+					// 欠落したフレームは捨て、次の SYN_REPORT でキーの状態から同期し直す
+					frame = frame[:0]
+					dropping = true
+				case consts.SynReport:
+					if dropping {
+						dropping = false
+						k.resync()
+						continue
+					}
+					if len(frame) == 0 {
+						continue
+					}
+					frame = append(frame, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+					if err := k.emit(frame); err != nil {
+						// 送り直せない状態でグラブを続けるとキーボードが使えなくなるため解除する
+						log.Printf("キー入力の送り直しに失敗したため、キーボードのグラブを解除します: %v", err)
+						k.mu.Lock()
+						k.releaseGrab()
+						k.mu.Unlock()
+						return
+					}
+					frame = frame[:0]
+				}
+			}
+		}
+	}
+}
+
+// shouldForward はキーイベントを送り直すかを判定し、押下中のキーを記録する
+func (k *grabbedKeyboard) shouldForward(e types.Event) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	switch e.Value {
+	case 0:
+		// 押したときに送り直したキーだけを離す
+		// 押している間に握りつぶす対象になったキーも、離す操作は送り直す
+		if !k.pressed[e.Code] {
+			return false
+		}
+		delete(k.pressed, e.Code)
+		return true
+	case 1:
+		if k.swallow[e.Code] {
+			return false
+		}
+		k.pressed[e.Code] = true
+		return true
+	default:
+		// キーリピートは仮想キーボード側で生成する
+		return false
+	}
+}
+
+// emit はイベントを仮想キーボードへ書き込む
+func (k *grabbedKeyboard) emit(events []types.Event) error {
+	return k.writer.write(events)
+}
+
+// resync はイベントの欠落後に、離されたキーを仮想キーボード側でも離す
+func (k *grabbedKeyboard) resync() {
+	held, err := getPressedKeys(k.File)
+	if err != nil {
+		return
+	}
+	down := make(map[uint16]bool, len(held))
+	for _, code := range held {
+		down[uint16(code)] = true
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var events []types.Event
+	for code := range k.pressed {
+		if !down[code] {
+			events = append(events, types.Event{Type: consts.Key, Code: code, Value: 0})
+			delete(k.pressed, code)
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+	if err := k.emit(events); err != nil {
+		log.Printf("キーの状態の同期に失敗しました: %v", err)
+	}
+}
+
+// mirrorLeds は仮想キーボードに設定されたLEDの状態を元のキーボードに反映する
+// Caps Lock などの表示を、グラブ中もキーボード本体で確認できるようにする
+func (k *grabbedKeyboard) mirrorLeds() {
+	defer k.wg.Done()
+
+	size := eventSize
+	buf := make([]byte, size*16)
+	leds := make([]types.Event, 0, len(buf)/size+1)
+	for {
+		n, err := readWithTimeout(k.output, buf, grabPollInterval)
+		if err != nil {
+			log.Printf("仮想キーボードの読み取りを終了します: %v", err)
+			return
+		}
+		select {
+		case <-k.done:
+			return
+		default:
+		}
+
+		leds = leds[:0]
+		for off := 0; off+size <= n; off += size {
+			e := decodeEvent(buf[off : off+size])
+			if e.Type == consts.Led {
+				leds = append(leds, types.Event{Type: e.Type, Code: e.Code, Value: e.Value})
+			}
+		}
+		if len(leds) == 0 {
+			continue
+		}
+		leds = append(leds, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+		if err := k.ledWriter.write(leds); err != nil {
+			log.Printf("キーボードのLEDの更新に失敗しました: %v", err)
+		}
+	}
+}
+
+// waitForAllReleased はキーボードのキーがすべて離されるまで待つ
+// Close された場合は false を返す
+func (k *grabbedKeyboard) waitForAllReleased() bool {
+	for {
+		held, err := getPressedKeys(k.File)
+		if err == nil && len(held) == 0 {
+			return true
+		}
+		select {
+		case <-k.done:
+			return false
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// releaseGrab はグラブを解除する。呼び出し側で mu をロックしておくこと
+func (k *grabbedKeyboard) releaseGrab() {
+	if !k.grabbed {
+		return
+	}
+	if err := utils.IOCtl(k.File, consts.EVIOCGRAB, 0); err != nil {
+		log.Printf("キーボードのグラブの解除に失敗しました: %v", err)
+	}
+	k.grabbed = false
+}
+
+// releasePressed は仮想キーボードで押下中のキーをすべて離す。呼び出し側で mu をロックしておくこと
+func (k *grabbedKeyboard) releasePressed() {
+	if len(k.pressed) == 0 {
+		return
+	}
+	events := make([]types.Event, 0, len(k.pressed)+1)
+	for code := range k.pressed {
+		events = append(events, types.Event{Type: consts.Key, Code: code, Value: 0})
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+	if err := k.emit(events); err != nil {
+		log.Printf("押下中のキーの解放に失敗しました: %v", err)
+	}
+	k.pressed = make(map[uint16]bool)
+}
+
+// getSupportedCodes はデバイスが通知するイベントコードの一覧を EVIOCGBIT で取得する
+func getSupportedCodes(file *os.File, evType int, max int) ([]int, error) {
+	bits := make([]byte, max/8+1)
+	// EVIOCGBIT(ev, len) = _IOC(_IOC_READ, 'E', 0x20 + ev, len)
+	req := 0x80000000 | uintptr(len(bits))<<16 | 'E'<<8 | uintptr(0x20+evType)
+	if err := utils.IOCtl(file, req, uintptr(unsafe.Pointer(&bits[0]))); err != nil {
+		return nil, err
+	}
+
+	var codes []int
+	for code := 0; code <= max; code++ {
+		if bits[code/8]&(1<<(code%8)) != 0 {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
@@ -0,0 +1,118 @@
+package features
+
+import (
+	"math"
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/utils"
+)
+
+// keystrokeBackend はトラックボールの移動量を一定量ごとのキー入力に変換する
+// 音量や明るさ、ズームなどを連続的に操作するために使用する
+type keystrokeBackend struct {
+	keys      KeyEmitter
+	keystroke KeystrokeOptions
+	combos    map[SwipeDirection][]int
+	accX      float64
+	accY      float64
+	lastEmit  time.Time
+}
+
+// 仮想キーボードを出力先とするキー入力変換バックエンドを作成する
+// 仮想キーボードは他のバックエンドと共有するため、Close では閉じない
+func NewKeystrokeBackend(keys KeyEmitter) GestureBackend {
+	return &keystrokeBackend{keys: keys}
+}
+
+func (b *keystrokeBackend) Begin(g Gesture) error {
+	b.keystroke = g.Keystroke
+	b.accX = 0
+	b.accY = 0
+	b.lastEmit = time.Time{}
+
+	b.combos = make(map[SwipeDirection][]int)
+	for dir, keys := range map[SwipeDirection]string{
+		SwipeUp:    g.Keystroke.Up,
+		SwipeDown:  g.Keystroke.Down,
+		SwipeLeft:  g.Keystroke.Left,
+		SwipeRight: g.Keystroke.Right,
+	} {
+		if keys == "" {
+			continue
+		}
+		codes, err := utils.ParseKeyCombo(keys)
+		if err != nil {
+			return err
+		}
+		b.combos[dir] = codes
+	}
+	return nil
+}
+
+func (b *keystrokeBackend) Move(m Motion) error {
+	if b.combos == nil {
+		return nil
+	}
+
+	step := b.keystroke.Step
+	b.accX = b.accumulate(b.accX+float64(m.DX), SwipeLeft, SwipeRight)
+	b.accY = b.accumulate(b.accY+float64(m.DY), SwipeUp, SwipeDown)
+
+	// 1回分の移動量に達した軸のキーを送信する。縦方向を優先する
+	for _, axis := range []struct {
+		acc      *float64
+		neg, pos SwipeDirection
+	}{
+		{&b.accY, SwipeUp, SwipeDown},
+		{&b.accX, SwipeLeft, SwipeRight},
+	} {
+		if math.Abs(*axis.acc) < step {
+			continue
+		}
+		if !b.canEmit(m.Time) {
+			return nil
+		}
+
+		dir := axis.pos
+		if *axis.acc < 0 {
+			dir = axis.neg
+		}
+		*axis.acc -= math.Copysign(step, *axis.acc)
+		b.lastEmit = m.Time
+		if err := b.keys.Tap(b.combos[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accumulate はキーが割り当てられていない方向の移動量を捨て、
+// 送信が追いつかない間に移動量がたまりすぎないよう1回分に制限する
+func (b *keystrokeBackend) accumulate(acc float64, neg SwipeDirection, pos SwipeDirection) float64 {
+	if acc < 0 && b.combos[neg] == nil || acc > 0 && b.combos[pos] == nil {
+		return 0
+	}
+	if b.keystroke.MaxRate > 0 {
+		limit := b.keystroke.Step
+		return math.Max(-limit, math.Min(limit, acc))
+	}
+	return acc
+}
+
+// canEmit は最大入力回数の制限内でキーを送信できるかを返す
+func (b *keystrokeBackend) canEmit(now time.Time) bool {
+	if b.keystroke.MaxRate <= 0 || b.lastEmit.IsZero() {
+		return true
+	}
+	interval := time.Duration(float64(time.Second) / b.keystroke.MaxRate)
+	return now.Sub(b.lastEmit) >= interval
+}
+
+func (b *keystrokeBackend) End() error {
+	b.combos = nil
+	return nil
+}
+
+func (b *keystrokeBackend) Close() error {
+	return b.End()
+}
@@ -1,17 +1,22 @@
 package features
 
 import (
-	"encoding/binary"
 	"fmt"
+	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/char5742/keyball-gestures/internal/consts"
 	"github.com/char5742/keyball-gestures/internal/types"
 	"github.com/char5742/keyball-gestures/internal/utils"
 )
 
+// イベントが届かないときに GetMouseDelta が待つ最大時間
+const mouseReadTimeout = 5 * time.Millisecond
+
 // マウス入力を扱うインターフェース
 type Mouse interface {
 	HandleSignals()
@@ -21,12 +26,31 @@ type Mouse interface {
 	Grab() error
 	// マウス操作の専有を解除する
 	Release() error
+	// 専有中に移動以外のイベントを送り直す仮想マウスと規則を設定する
+	SetPassthrough(pointer Pointer, rules PassthroughRules)
 	Close() error
 }
 
+// PassthroughRules は専有中に読み取ったイベントのうち、仮想マウスから送り直すものを表す
+// 送り直すのはボタンとホイールのみで、MSC_SCAN やその他の相対軸などは送り直さない
+type PassthroughRules struct {
+	Buttons     bool // 左・右・中ボタン
+	SideButtons bool // サイドボタンなどの追加ボタン
+	Wheel       bool // ホイール
+}
+
 type virtualMouse struct {
 	file    *os.File
 	grabbed bool
+	buf     [eventSize]byte // 読み取り用のバッファ。呼び出しごとに確保しないよう使い回す
+
+	// 専有中に移動以外のイベントを送り直す先
+	passthrough      Pointer
+	passthroughRules PassthroughRules
+	pending          []types.Event // 次の SYN_REPORT で送り直すイベント
+
+	// 専有した時点で押されていたボタン。仮想マウスが押したことにして引き継ぎ、規則によらず離すイベントを送り直す
+	heldAtGrab map[uint16]bool
 }
 
 // 指定されたパスでマウスを作成する
@@ -35,7 +59,7 @@ func CreateMouse(path string) (Mouse, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open device file: %w", err)
 	}
-	return &virtualMouse{file: f}, nil
+	return &virtualMouse{file: f, heldAtGrab: make(map[uint16]bool)}, nil
 }
 
 func (m *virtualMouse) HandleSignals() {
@@ -49,33 +73,83 @@ func (m *virtualMouse) HandleSignals() {
 }
 
 func (m *virtualMouse) GetMouseDelta() (dx int32, dy int32) {
-	var e types.Event
-	size := binary.Size(e)
-	buf := make([]byte, size)
+	buf := m.buf[:]
 
-	_, err := m.file.Read(buf)
-	if err != nil {
+	// 動かしていない間もキーの状態や長押しを判定できるよう、一定時間で読み取りを打ち切る
+	n, err := readWithTimeout(m.file, buf, mouseReadTimeout)
+	if err != nil || n < len(buf) {
 		return 0, 0
 	}
 
-	e.Time.Sec = int64(binary.LittleEndian.Uint64(buf[0:8]))
-	e.Time.Usec = int64(binary.LittleEndian.Uint64(buf[8:16]))
-	e.Type = binary.LittleEndian.Uint16(buf[16:18])
-	e.Code = binary.LittleEndian.Uint16(buf[18:20])
-	e.Value = int32(binary.LittleEndian.Uint32(buf[20:24]))
+	e := decodeEvent(buf)
 
 	if e.Type == consts.Rel {
 		switch e.Code {
 		case consts.RelX:
 			dx += e.Value
+			return dx, dy
 		case consts.RelY:
 			dy += e.Value
+			return dx, dy
 		}
 	}
 
+	if m.grabbed && m.passthrough != nil {
+		m.passEvent(e)
+	}
+
 	return dx, dy
 }
 
+func (m *virtualMouse) SetPassthrough(pointer Pointer, rules PassthroughRules) {
+	m.passthrough = pointer
+	m.passthroughRules = rules
+	m.pending = m.pending[:0]
+	if m.grabbed {
+		m.takeOverHeldButtons()
+	}
+}
+
+// passEvent は専有中に読み取った移動以外のイベントを規則に従って送り直す
+// イベントは SYN_REPORT までまとめ、1フレームとして送信する
+func (m *virtualMouse) passEvent(e types.Event) {
+	switch e.Type {
+	case consts.Syn:
+		if e.Code != consts.SynReport || len(m.pending) == 0 {
+			return
+		}
+		m.pending = append(m.pending, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+		if err := m.passthrough.Emit(m.pending); err != nil {
+			log.Printf("イベントの送り直しに失敗しました: %v", err)
+		}
+		m.pending = m.pending[:0]
+
+	case consts.Key:
+		pass := m.passthroughRules.Buttons
+		if e.Code >= consts.MouseBtnSide {
+			pass = m.passthroughRules.SideButtons
+		}
+		if m.heldAtGrab[e.Code] {
+			// 引き継いだボタンは離さないと押されたままになるため、規則によらず送り直す
+			pass = true
+			if e.Value == 0 {
+				delete(m.heldAtGrab, e.Code)
+			}
+		}
+		if pass {
+			m.pending = append(m.pending, types.Event{Type: e.Type, Code: e.Code, Value: e.Value})
+		}
+
+	case consts.Rel:
+		switch e.Code {
+		case consts.RelWheel, consts.RelHWheel, consts.RelWheelHiRes, consts.RelHWheelHiRes:
+			if m.passthroughRules.Wheel {
+				m.pending = append(m.pending, types.Event{Type: e.Type, Code: e.Code, Value: e.Value})
+			}
+		}
+	}
+}
+
 func (m *virtualMouse) Grab() error {
 	if m.grabbed {
 		return nil
@@ -84,9 +158,45 @@ func (m *virtualMouse) Grab() error {
 		return fmt.Errorf("failed to grab device: %w", err)
 	}
 	m.grabbed = true
+	m.seedHeldButtons()
+	m.takeOverHeldButtons()
 	return nil
 }
 
+// seedHeldButtons は専有した時点で押されているボタンを EVIOCGKEY で調べて記録する
+// 専有中に離しても元のデバイスからは通知されないため、これらのボタンは仮想マウスから離す
+func (m *virtualMouse) seedHeldButtons() {
+	clear(m.heldAtGrab)
+
+	var bits [consts.KeyMax/8 + 1]byte
+	if err := utils.IOCtl(m.file, consts.GetKeyState(len(bits)), uintptr(unsafe.Pointer(&bits[0]))); err != nil {
+		log.Printf("ボタンの状態を取得できませんでした: %v", err)
+		return
+	}
+	for code := consts.MouseBtnLeft; code <= consts.MouseBtnTask; code++ {
+		if bits[code/8]&(1<<(code%8)) != 0 {
+			m.heldAtGrab[uint16(code)] = true
+		}
+	}
+}
+
+// takeOverHeldButtons は専有前から押されているボタンを仮想マウスからも押し、離すイベントを送れるようにする
+// カーネルは押されていないボタンを離すイベントを捨てるため、先に押しておく必要がある。
+// 元のデバイスのボタンはコンポジターから見て押されたままになり、次にそのボタンを押して離すまで解消しない
+func (m *virtualMouse) takeOverHeldButtons() {
+	if m.passthrough == nil || len(m.heldAtGrab) == 0 {
+		return
+	}
+	events := make([]types.Event, 0, len(m.heldAtGrab)+1)
+	for code := range m.heldAtGrab {
+		events = append(events, types.Event{Type: consts.Key, Code: code, Value: 1})
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+	if err := m.passthrough.Emit(events); err != nil {
+		log.Printf("専有前から押されていたボタンの引き継ぎに失敗しました: %v", err)
+	}
+}
+
 func (m *virtualMouse) Release() error {
 	if !m.grabbed {
 		return nil
@@ -95,6 +205,15 @@ func (m *virtualMouse) Release() error {
 		return fmt.Errorf("failed to release device: %w", err)
 	}
 	m.grabbed = false
+	clear(m.heldAtGrab)
+
+	// 専有中に押したボタンを解除後に離すと元のデバイスから通知されるため、仮想マウス側で離しておく
+	if m.passthrough != nil {
+		m.pending = m.pending[:0]
+		if err := m.passthrough.ReleaseButtons(); err != nil {
+			log.Printf("送り直したボタンの解放に失敗しました: %v", err)
+		}
+	}
 	return nil
 }
 
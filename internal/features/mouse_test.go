@@ -0,0 +1,107 @@
+package features
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// newPipeMouse はパイプから読み取るマウスと、イベントを書き込む側のファイルを返す
+func newPipeMouse(tb testing.TB) (*virtualMouse, *os.File) {
+	tb.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		_ = r.Close()
+		_ = w.Close()
+	})
+	return &virtualMouse{file: r, heldAtGrab: make(map[uint16]bool)}, w
+}
+
+func TestGetMouseDeltaDoesNotAllocate(t *testing.T) {
+	m, w := newPipeMouse(t)
+	event := appendEvent(nil, types.Event{Type: consts.Rel, Code: consts.RelX, Value: 3})
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		if _, err := w.Write(event); err != nil {
+			t.Fatal(err)
+		}
+		if dx, _ := m.GetMouseDelta(); dx != 3 {
+			t.Fatalf("移動量が違います: got %d, want 3", dx)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("GetMouseDelta がメモリを確保しました: %v allocs/op", allocs)
+	}
+}
+
+func BenchmarkGetMouseDelta(b *testing.B) {
+	m, w := newPipeMouse(b)
+	event := appendEvent(nil, types.Event{Type: consts.Rel, Code: consts.RelX, Value: 3})
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := w.Write(event); err != nil {
+			b.Fatal(err)
+		}
+		m.GetMouseDelta()
+	}
+}
+
+// recordingPointer は送信されたイベントのフレームを記録する仮想マウス
+type recordingPointer struct {
+	frames [][]types.Event
+}
+
+func (p *recordingPointer) Move(int32, int32) error  { return nil }
+func (p *recordingPointer) Wheel(int32, int32) error { return nil }
+func (p *recordingPointer) ResetWheel()              {}
+func (p *recordingPointer) ReleaseButtons() error    { return nil }
+func (p *recordingPointer) Close() error             { return nil }
+
+func (p *recordingPointer) Emit(events []types.Event) error {
+	p.frames = append(p.frames, slices.Clone(events))
+	return nil
+}
+
+func TestPassthroughReleasesButtonsHeldAtGrab(t *testing.T) {
+	m, w := newPipeMouse(t)
+	// 左ボタンを押したまま専有した状態。ボタンは送り直さない規則にする
+	m.grabbed = true
+	m.heldAtGrab[consts.MouseBtnLeft] = true
+	pointer := &recordingPointer{}
+	m.SetPassthrough(pointer, PassthroughRules{})
+
+	syn := types.Event{Type: consts.Syn, Code: consts.SynReport}
+	press := types.Event{Type: consts.Key, Code: consts.MouseBtnLeft, Value: 1}
+	release := types.Event{Type: consts.Key, Code: consts.MouseBtnLeft, Value: 0}
+	if len(pointer.frames) != 1 || !slices.Equal(pointer.frames[0], []types.Event{press, syn}) {
+		t.Fatalf("押されていたボタンを仮想マウスが引き継いでいません: %v", pointer.frames)
+	}
+
+	// 専有中に離すと、規則によらず仮想マウスから離す
+	for _, e := range []types.Event{release, syn} {
+		if _, err := w.Write(appendEvent(nil, e)); err != nil {
+			t.Fatal(err)
+		}
+		m.GetMouseDelta()
+	}
+	if len(pointer.frames) != 2 || !slices.Equal(pointer.frames[1], []types.Event{release, syn}) {
+		t.Fatalf("離したことが送り直されていません: %v", pointer.frames)
+	}
+
+	// 2回目以降のクリックは規則に従って送り直さない
+	for _, e := range []types.Event{press, syn, release, syn} {
+		if _, err := w.Write(appendEvent(nil, e)); err != nil {
+			t.Fatal(err)
+		}
+		m.GetMouseDelta()
+	}
+	if len(pointer.frames) != 2 {
+		t.Fatalf("規則に反して送り直しました: %v", pointer.frames[2:])
+	}
+}
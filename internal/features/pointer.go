@@ -0,0 +1,151 @@
+package features
+
+import (
+	"io"
+	"os"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// 相対座標出力デバイス（仮想マウス）を表現するインターフェース
+type Pointer interface {
+	// ポインターを相対的に移動する
+	Move(dx int32, dy int32) error
+	// 高解像度ホイールの値（1ノッチ = 120）でスクロールする
+	Wheel(vertical int32, horizontal int32) error
+	// 通常のホイールイベントに換算しきれていない高解像度の値を破棄する
+	ResetWheel()
+	// イベントをそのまま送信する
+	Emit(events []types.Event) error
+	// 押されたままのボタンをすべて離す
+	ReleaseButtons() error
+	io.Closer
+}
+
+type virtualPointer struct {
+	name       []byte
+	deviceFile *os.File
+	writer     *eventWriter
+	pressed    map[uint16]bool // 押されているボタン
+
+	// 通常のホイールイベントに換算するまで蓄積している高解像度の値
+	pendingVertical   int32
+	pendingHorizontal int32
+}
+
+// 新しい仮想マウスデバイスを作成する
+func CreatePointer(path string, name []byte) (Pointer, error) {
+	fd, err := createUinputDevice(path, uinputProfile{
+		kind: VirtualDevicePointer,
+		name: name,
+		id: types.InputID{
+			Bustype: consts.BusUsb,
+			Vendor:  consts.VirtualDeviceVendor,
+			Product: 0x0818,
+			Version: 1,
+		},
+		// libinput にポインターとして認識させるためボタンと移動軸も通知する
+		keys: []int{
+			consts.MouseBtnLeft,
+			consts.MouseBtnRight,
+			consts.MouseBtnMiddle,
+			consts.MouseBtnSide,
+			consts.MouseBtnExtra,
+			consts.MouseBtnFwd,
+			consts.MouseBtnBack,
+			consts.MouseBtnTask,
+		},
+		rels: []int{
+			consts.RelX,
+			consts.RelY,
+			consts.RelWheel,
+			consts.RelHWheel,
+			consts.RelWheelHiRes,
+			consts.RelHWheelHiRes,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &virtualPointer{name: name, deviceFile: fd, writer: newEventWriter(fd), pressed: make(map[uint16]bool)}, nil
+}
+
+func (vp *virtualPointer) Close() error {
+	_ = vp.ReleaseButtons()
+	_ = releaseDevice(vp.deviceFile)
+	return vp.deviceFile.Close()
+}
+
+func (vp *virtualPointer) Move(dx int32, dy int32) error {
+	if dx == 0 && dy == 0 {
+		return nil
+	}
+	events := make([]types.Event, 0, 3)
+	if dx != 0 {
+		events = append(events, types.Event{Type: consts.Rel, Code: consts.RelX, Value: dx})
+	}
+	if dy != 0 {
+		events = append(events, types.Event{Type: consts.Rel, Code: consts.RelY, Value: dy})
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+	return vp.writer.write(events)
+}
+
+// 高解像度ホイールイベントを送信する
+// 高解像度に対応しないアプリケーションのため、1ノッチ分たまるごとに通常のホイールイベントも送信する
+func (vp *virtualPointer) Wheel(vertical int32, horizontal int32) error {
+	if vertical == 0 && horizontal == 0 {
+		return nil
+	}
+
+	events := make([]types.Event, 0, 5)
+	if vertical != 0 {
+		events = append(events, types.Event{Type: consts.Rel, Code: consts.RelWheelHiRes, Value: vertical})
+		vp.pendingVertical += vertical
+		if detents := vp.pendingVertical / consts.WheelHiResPerDetent; detents != 0 {
+			events = append(events, types.Event{Type: consts.Rel, Code: consts.RelWheel, Value: detents})
+			vp.pendingVertical -= detents * consts.WheelHiResPerDetent
+		}
+	}
+	if horizontal != 0 {
+		events = append(events, types.Event{Type: consts.Rel, Code: consts.RelHWheelHiRes, Value: horizontal})
+		vp.pendingHorizontal += horizontal
+		if detents := vp.pendingHorizontal / consts.WheelHiResPerDetent; detents != 0 {
+			events = append(events, types.Event{Type: consts.Rel, Code: consts.RelHWheel, Value: detents})
+			vp.pendingHorizontal -= detents * consts.WheelHiResPerDetent
+		}
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+
+	return vp.writer.write(events)
+}
+
+func (vp *virtualPointer) ResetWheel() {
+	vp.pendingVertical = 0
+	vp.pendingHorizontal = 0
+}
+
+func (vp *virtualPointer) Emit(events []types.Event) error {
+	for _, ev := range events {
+		if ev.Type == consts.Key {
+			vp.pressed[ev.Code] = ev.Value != 0
+		}
+	}
+	return vp.writer.write(events)
+}
+
+func (vp *virtualPointer) ReleaseButtons() error {
+	var events []types.Event
+	for code, down := range vp.pressed {
+		if down {
+			events = append(events, types.Event{Type: consts.Key, Code: code, Value: 0})
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	events = append(events, types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0})
+	return vp.Emit(events)
+}
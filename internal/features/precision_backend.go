@@ -0,0 +1,52 @@
+package features
+
+// precisionBackend はトラックボールの移動量に倍率をかけて仮想マウスから出力する
+// キーを押している間だけ感度を下げる、ファームウェアの書き換えが不要なスナイパーモード
+type precisionBackend struct {
+	pointer Pointer
+	scale   float64
+
+	// 1カウントに満たず出力できなかった端数
+	remainderX float64
+	remainderY float64
+}
+
+// 仮想マウスのポインター移動を出力先とするバックエンドを作成する
+func NewPrecisionBackend(pointer Pointer) GestureBackend {
+	return &precisionBackend{pointer: pointer}
+}
+
+func (b *precisionBackend) Begin(g Gesture) error {
+	b.scale = g.PrecisionScale
+	b.remainderX = 0
+	b.remainderY = 0
+	return nil
+}
+
+func (b *precisionBackend) Move(m Motion) error {
+	// フィルターや mouse_delta_factor による加工を避けるため、トラックボールの生の移動量を使う
+	if m.RawDX == 0 && m.RawDY == 0 {
+		return nil
+	}
+
+	// 倍率が1未満のときは小さな移動が切り捨てられないよう端数を持ち越す
+	x := float64(m.RawDX)*b.scale + b.remainderX
+	y := float64(m.RawDY)*b.scale + b.remainderY
+
+	dx := int32(x)
+	dy := int32(y)
+	b.remainderX = x - float64(dx)
+	b.remainderY = y - float64(dy)
+
+	return b.pointer.Move(dx, dy)
+}
+
+func (b *precisionBackend) End() error {
+	b.remainderX = 0
+	b.remainderY = 0
+	return nil
+}
+
+func (b *precisionBackend) Close() error {
+	return b.pointer.Close()
+}
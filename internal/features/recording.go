@@ -0,0 +1,204 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 記録したタッチ操作の種類
+const (
+	TouchOpContact    = "contact"     // 接触サイズと圧力の設定 (touch_major, pressure)
+	TouchOpDown       = "down"        // 指を置く (slot, tracking_id, x, y)
+	TouchOpMove       = "move"        // 指を動かす (slot, x, y)
+	TouchOpUp         = "up"          // 指を離す (slot)
+	TouchOpSingleMove = "single_move" // 1本指の相対移動 (dx, dy)
+	TouchOpSingleUp   = "single_up"   // 1本指を離す
+)
+
+// TouchFrame は TouchPad に対する1回の操作と、記録開始からの経過時間を表す
+type TouchFrame struct {
+	Time       int64  `json:"t_us"` // 記録開始からの経過時間（マイクロ秒）
+	Op         string `json:"op"`
+	Slot       int    `json:"slot,omitempty"`
+	TrackingID int    `json:"tracking_id,omitempty"`
+	X          int32  `json:"x,omitempty"`
+	Y          int32  `json:"y,omitempty"`
+	DX         int32  `json:"dx,omitempty"`
+	DY         int32  `json:"dy,omitempty"`
+	TouchMajor int32  `json:"touch_major,omitempty"`
+	Pressure   int32  `json:"pressure,omitempty"`
+}
+
+// TouchRecording は名前を付けて保存したタッチ操作の記録を表す
+//
+// ファイル形式（<設定ディレクトリ>/recordings/<name>.json）:
+//
+//	{
+//	  "name": "three-finger-left",
+//	  "recorded_at": "2024-01-01T12:00:00+09:00",
+//	  "touchpad": {"min_x": 0, "max_x": 32767, "min_y": 0, "max_y": 32767},
+//	  "frames": [
+//	    {"t_us": 0, "op": "contact", "touch_major": 50, "pressure": 30},
+//	    {"t_us": 0, "op": "down", "slot": 0, "tracking_id": 1, "x": 16383, "y": 16383},
+//	    {"t_us": 8000, "op": "move", "slot": 0, "x": 16200, "y": 16383},
+//	    {"t_us": 250000, "op": "up", "slot": 0}
+//	  ]
+//	}
+//
+// touchpad は記録時のタッチパッドの範囲で、再生時の範囲と異なる場合は座標を比例させて変換する。
+// 値が0の項目は省略される。
+type TouchRecording struct {
+	Name       string         `json:"name"`
+	RecordedAt time.Time      `json:"recorded_at"`
+	TouchPad   TouchPadBounds `json:"touchpad"`
+	Frames     []TouchFrame   `json:"frames"`
+}
+
+// TouchPadBounds はタッチパッドの座標の範囲を表す
+type TouchPadBounds struct {
+	MinX int32 `json:"min_x"`
+	MaxX int32 `json:"max_x"`
+	MinY int32 `json:"min_y"`
+	MaxY int32 `json:"max_y"`
+}
+
+// Duration は記録の長さを返す
+func (r TouchRecording) Duration() time.Duration {
+	if len(r.Frames) == 0 {
+		return 0
+	}
+	return time.Duration(r.Frames[len(r.Frames)-1].Time) * time.Microsecond
+}
+
+// RecordingStore はタッチ操作の記録をディレクトリに保存する
+// 次のジェスチャーを記録する予約も管理する
+type RecordingStore struct {
+	dir string
+
+	mu        sync.Mutex
+	recording string // 次のジェスチャーを記録する名前
+}
+
+// 指定したディレクトリに記録を保存するストアを作成する
+func NewRecordingStore(dir string) *RecordingStore {
+	return &RecordingStore{dir: dir}
+}
+
+// List は保存されている記録を名前順に返す
+func (s *RecordingStore) List() ([]TouchRecording, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []TouchRecording{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("記録ディレクトリの読み込みに失敗しました: %w", err)
+	}
+
+	recordings := []TouchRecording{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok || !storeNamePattern.MatchString(name) {
+			continue
+		}
+		r, err := s.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, r)
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].Name < recordings[j].Name })
+	return recordings, nil
+}
+
+// Load は名前を指定して記録を読み込む
+func (s *RecordingStore) Load(name string) (TouchRecording, error) {
+	if !storeNamePattern.MatchString(name) {
+		return TouchRecording{}, fmt.Errorf("記録の名前が不正です: %q", name)
+	}
+	data, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return TouchRecording{}, fmt.Errorf("記録 %s の読み込みに失敗しました: %w", name, err)
+	}
+	var r TouchRecording
+	if err := json.Unmarshal(data, &r); err != nil {
+		return TouchRecording{}, fmt.Errorf("記録 %s の解析に失敗しました: %w", name, err)
+	}
+	r.Name = name
+	return r, nil
+}
+
+// Save は記録を保存する。同じ名前の記録は上書きする
+func (s *RecordingStore) Save(r TouchRecording) error {
+	if !storeNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("記録の名前は英数字、'-'、'_' の64文字以内で指定してください: %q", r.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("記録ディレクトリの作成に失敗しました: %w", err)
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("記録のエンコードに失敗しました: %w", err)
+	}
+	if err := os.WriteFile(s.path(r.Name), data, 0644); err != nil {
+		return fmt.Errorf("記録の保存に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// Delete は記録を削除する
+func (s *RecordingStore) Delete(name string) error {
+	if !storeNamePattern.MatchString(name) {
+		return fmt.Errorf("記録の名前が不正です: %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(name)); err != nil {
+		return fmt.Errorf("記録の削除に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// Record は次のタッチパッドのジェスチャーを name として記録するよう予約する
+func (s *RecordingStore) Record(name string) error {
+	if !storeNamePattern.MatchString(name) {
+		return fmt.Errorf("記録の名前は英数字、'-'、'_' の64文字以内で指定してください: %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recording = name
+	return nil
+}
+
+// Recording は記録を予約している名前を返す
+func (s *RecordingStore) Recording() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recording
+}
+
+// TakeRecording は記録の予約を取り出して解除する
+func (s *RecordingStore) TakeRecording() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := s.recording
+	s.recording = ""
+	return name
+}
+
+func (s *RecordingStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
@@ -0,0 +1,48 @@
+package features
+
+import (
+	"errors"
+	"log"
+)
+
+// replayBackend はキーを押したときに記録したタッチ操作を再生する
+// 再生は記録どおりのタイミングで最後まで行い、キーを離しても中断しない
+type replayBackend struct {
+	player *TouchPlayer
+	store  *RecordingStore
+}
+
+// 記録の再生を出力とするバックエンドを作成する
+func NewReplayBackend(player *TouchPlayer, store *RecordingStore) GestureBackend {
+	return &replayBackend{player: player, store: store}
+}
+
+func (b *replayBackend) Begin(g Gesture) error {
+	rec, err := b.store.Load(g.Replay)
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.player.Play(rec); err != nil {
+		if errors.Is(err, ErrPlaybackBusy) {
+			log.Printf("再生中のため記録 %s の再生を見送りました", rec.Name)
+			return nil
+		}
+		return err
+	}
+	log.Printf("記録を再生します: %s (%v)", rec.Name, rec.Duration())
+	return nil
+}
+
+func (b *replayBackend) Move(m Motion) error {
+	return nil
+}
+
+func (b *replayBackend) End() error {
+	return nil
+}
+
+// 再生器はサービスが所有するため、ここでは何もしない
+func (b *replayBackend) Close() error {
+	return nil
+}
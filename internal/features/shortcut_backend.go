@@ -0,0 +1,66 @@
+package features
+
+import (
+	"log"
+)
+
+// shortcutBackend はスワイプの方向を認識し、方向ごとに設定された動作を実行する
+type shortcutBackend struct {
+	actions    ActionExecutor
+	swipe      SwipeOptions
+	fingers    int
+	recognizer *SwipeRecognizer
+	fired      map[SwipeDirection]bool
+}
+
+// スワイプ認識バックエンドを作成する
+func NewShortcutBackend(actions ActionExecutor) GestureBackend {
+	return &shortcutBackend{actions: actions}
+}
+
+func (b *shortcutBackend) Begin(g Gesture) error {
+	b.swipe = g.Swipe
+	b.fingers = g.Fingers
+	b.recognizer = NewSwipeRecognizer(g.Swipe.Distance, g.Swipe.Velocity)
+	b.fired = make(map[SwipeDirection]bool)
+	return nil
+}
+
+func (b *shortcutBackend) Move(m Motion) error {
+	if b.recognizer == nil {
+		return nil
+	}
+
+	swipe, ok := b.recognizer.Feed(m.DX, m.DY, m.Time)
+	if !ok {
+		return nil
+	}
+
+	dir := swipe.Direction
+	action := b.swipe.Actions[dir]
+	if action.Kind == "" {
+		return nil
+	}
+	// repeat = "once" の方向はキーを押している間に1回だけ実行する
+	if !action.Repeat && b.fired[dir] {
+		return nil
+	}
+	b.fired[dir] = true
+
+	log.Printf("スワイプを認識しました: %s", dir)
+	return b.actions.Execute(action.Action, GestureInfo{
+		Direction: string(dir),
+		Fingers:   b.fingers,
+		Distance:  swipe.Distance,
+		Duration:  swipe.Duration,
+	})
+}
+
+func (b *shortcutBackend) End() error {
+	b.recognizer = nil
+	return nil
+}
+
+func (b *shortcutBackend) Close() error {
+	return b.End()
+}
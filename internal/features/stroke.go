@@ -0,0 +1,197 @@
+package features
+
+import (
+	"math"
+)
+
+// $1 Unistroke Recognizer (Wobbrock ら, 2007) による図形認識
+//
+// マウスジェスチャーでは向きが意味を持つため（上に払う L と右に払う L は別の操作）、
+// 元の手法の「代表角度に合わせて回転する」正規化は行わず、描き方のぶれを吸収する
+// 小さな角度の範囲でのみ回転させて照合する。
+const (
+	strokeSamplePoints    = 64    // 再標本化後の点の数
+	strokeSquareSize      = 250.0 // 正規化後の正方形の一辺
+	strokeAngleRange      = 15.0 * math.Pi / 180
+	strokeAnglePrecision  = 2.0 * math.Pi / 180
+	strokeOneDimThreshold = 0.3 // 縦横比がこれより小さい図形は直線とみなし、縦横比を保って拡大する
+)
+
+var (
+	strokeHalfDiagonal = 0.5 * math.Sqrt(2*strokeSquareSize*strokeSquareSize)
+	strokeGoldenRatio  = 0.5 * (math.Sqrt(5) - 1)
+)
+
+// StrokePoint はストローク上の点 (x, y) を表す
+type StrokePoint [2]float64
+
+// StrokeRecognizer は登録されたテンプレートとの一致度から図形を認識する
+type StrokeRecognizer struct {
+	names   []string
+	samples [][]StrokePoint // 正規化済みの点列
+}
+
+// テンプレートから認識器を作成する
+// 点が足りないサンプルは無視する
+func NewStrokeRecognizer(templates []StrokeTemplate) *StrokeRecognizer {
+	r := &StrokeRecognizer{}
+	for _, t := range templates {
+		for _, sample := range t.Samples {
+			points, ok := normalizeStroke(sample)
+			if !ok {
+				continue
+			}
+			r.names = append(r.names, t.Name)
+			r.samples = append(r.samples, points)
+		}
+	}
+	return r
+}
+
+// Recognize は最も一致するテンプレート名と一致度 (0-1) を返す
+// テンプレートがない場合や点が足りない場合は空文字列を返す
+func (r *StrokeRecognizer) Recognize(points []StrokePoint) (name string, score float64) {
+	candidate, ok := normalizeStroke(points)
+	if !ok || len(r.samples) == 0 {
+		return "", 0
+	}
+
+	best := math.Inf(1)
+	for i, sample := range r.samples {
+		d := distanceAtBestAngle(candidate, sample, -strokeAngleRange, strokeAngleRange, strokeAnglePrecision)
+		if d < best {
+			best = d
+			name = r.names[i]
+		}
+	}
+	return name, max(0, 1-best/strokeHalfDiagonal)
+}
+
+// normalizeStroke は点列を等間隔に再標本化し、大きさと位置をそろえる
+func normalizeStroke(points []StrokePoint) ([]StrokePoint, bool) {
+	if len(points) < 2 || pathLength(points) == 0 {
+		return nil, false
+	}
+	pts := resampleStroke(points, strokeSamplePoints)
+	pts = scaleStroke(pts, strokeSquareSize)
+	return translateStroke(pts), true
+}
+
+// resampleStroke は経路に沿って n 個の等間隔な点に置き換える
+func resampleStroke(points []StrokePoint, n int) []StrokePoint {
+	interval := pathLength(points) / float64(n-1)
+	src := append([]StrokePoint(nil), points...)
+	out := make([]StrokePoint, 0, n)
+	out = append(out, src[0])
+
+	acc := 0.0
+	for i := 1; i < len(src); i++ {
+		d := pointDistance(src[i-1], src[i])
+		if d > 0 && acc+d >= interval {
+			t := (interval - acc) / d
+			q := StrokePoint{
+				src[i-1][0] + t*(src[i][0]-src[i-1][0]),
+				src[i-1][1] + t*(src[i][1]-src[i-1][1]),
+			}
+			out = append(out, q)
+			// 補間した点から次の区間を数える
+			src = append(src[:i], append([]StrokePoint{q}, src[i:]...)...)
+			acc = 0
+		} else {
+			acc += d
+		}
+	}
+	// 丸め誤差で最後の点が足りない場合は終点で補う
+	for len(out) < n {
+		out = append(out, src[len(src)-1])
+	}
+	return out[:n]
+}
+
+// scaleStroke は外接矩形が一辺 size の正方形に収まるよう拡大・縮小する
+// 直線に近い図形は縦横比を保つ
+func scaleStroke(points []StrokePoint, size float64) []StrokePoint {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range points {
+		minX, maxX = min(minX, p[0]), max(maxX, p[0])
+		minY, maxY = min(minY, p[1]), max(maxY, p[1])
+	}
+	w, h := maxX-minX, maxY-minY
+
+	sx, sy := size/w, size/h
+	if min(w, h)/max(w, h) < strokeOneDimThreshold {
+		s := size / max(w, h)
+		sx, sy = s, s
+	}
+
+	out := make([]StrokePoint, len(points))
+	for i, p := range points {
+		out[i] = StrokePoint{p[0] * sx, p[1] * sy}
+	}
+	return out
+}
+
+// translateStroke は重心が原点になるよう平行移動する
+func translateStroke(points []StrokePoint) []StrokePoint {
+	var cx, cy float64
+	for _, p := range points {
+		cx += p[0]
+		cy += p[1]
+	}
+	cx /= float64(len(points))
+	cy /= float64(len(points))
+
+	out := make([]StrokePoint, len(points))
+	for i, p := range points {
+		out[i] = StrokePoint{p[0] - cx, p[1] - cy}
+	}
+	return out
+}
+
+// distanceAtBestAngle は黄金分割探索で最も近くなる回転角を探し、そのときの距離を返す
+func distanceAtBestAngle(points, template []StrokePoint, a, b, threshold float64) float64 {
+	x1 := strokeGoldenRatio*a + (1-strokeGoldenRatio)*b
+	f1 := distanceAtAngle(points, template, x1)
+	x2 := (1-strokeGoldenRatio)*a + strokeGoldenRatio*b
+	f2 := distanceAtAngle(points, template, x2)
+
+	for math.Abs(b-a) > threshold {
+		if f1 < f2 {
+			b = x2
+			x2, f2 = x1, f1
+			x1 = strokeGoldenRatio*a + (1-strokeGoldenRatio)*b
+			f1 = distanceAtAngle(points, template, x1)
+		} else {
+			a = x1
+			x1, f1 = x2, f2
+			x2 = (1-strokeGoldenRatio)*a + strokeGoldenRatio*b
+			f2 = distanceAtAngle(points, template, x2)
+		}
+	}
+	return min(f1, f2)
+}
+
+// distanceAtAngle は点列を重心まわりに回転させたときのテンプレートとの平均距離を返す
+// 点列は正規化済みで重心が原点にあるものとする
+func distanceAtAngle(points, template []StrokePoint, angle float64) float64 {
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	var d float64
+	for i, p := range points {
+		q := StrokePoint{p[0]*cos - p[1]*sin, p[0]*sin + p[1]*cos}
+		d += pointDistance(q, template[i])
+	}
+	return d / float64(len(points))
+}
+
+func pathLength(points []StrokePoint) float64 {
+	var d float64
+	for i := 1; i < len(points); i++ {
+		d += pointDistance(points[i-1], points[i])
+	}
+	return d
+}
+
+func pointDistance(a, b StrokePoint) float64 {
+	return math.Hypot(b[0]-a[0], b[1]-a[1])
+}
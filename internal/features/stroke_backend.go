@@ -0,0 +1,100 @@
+package features
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// strokeBackend はキーを押している間に描いた図形を認識し、図形ごとに設定された動作を実行する
+// 記録が予約されている場合は、認識する代わりに描いた図形をテンプレートとして保存する
+type strokeBackend struct {
+	actions ActionExecutor
+	store   *StrokeStore
+
+	stroke     StrokeOptions
+	fingers    int
+	recognizer *StrokeRecognizer
+	points     []StrokePoint
+	x, y       float64
+	distance   float64
+	start      time.Time
+}
+
+// 図形認識バックエンドを作成する
+func NewStrokeBackend(actions ActionExecutor, store *StrokeStore) GestureBackend {
+	return &strokeBackend{actions: actions, store: store}
+}
+
+func (b *strokeBackend) Begin(g Gesture) error {
+	b.stroke = g.Stroke
+	b.fingers = g.Fingers
+
+	// API から追加されたテンプレートを反映するため、ジェスチャーごとに読み込み直す
+	templates, err := b.store.List()
+	if err != nil {
+		log.Printf("図形のテンプレートの読み込みに失敗しました: %v", err)
+	}
+	b.recognizer = NewStrokeRecognizer(templates)
+
+	b.points = append(b.points[:0], StrokePoint{0, 0})
+	b.x, b.y = 0, 0
+	b.distance = 0
+	b.start = time.Now()
+	return nil
+}
+
+func (b *strokeBackend) Move(m Motion) error {
+	if m.DX == 0 && m.DY == 0 {
+		return nil
+	}
+	b.x += float64(m.DX)
+	b.y += float64(m.DY)
+	b.distance += math.Hypot(float64(m.DX), float64(m.DY))
+	b.points = append(b.points, StrokePoint{b.x, b.y})
+	return nil
+}
+
+func (b *strokeBackend) End() error {
+	recognizer := b.recognizer
+	if recognizer == nil {
+		return nil
+	}
+	b.recognizer = nil
+
+	// キーを押して離しただけの操作やわずかな移動は図形として扱わない
+	if b.distance < b.stroke.MinDistance {
+		return nil
+	}
+
+	if name := b.store.takeRecording(); name != "" {
+		if err := b.store.Add(name, b.points); err != nil {
+			return err
+		}
+		log.Printf("図形のテンプレートを記録しました: %s (%d点)", name, len(b.points))
+		return nil
+	}
+
+	name, score := recognizer.Recognize(b.points)
+	if name == "" || score < b.stroke.Threshold {
+		log.Printf("図形を認識できませんでした: 候補=%q, 一致度=%.2f", name, score)
+		return nil
+	}
+	log.Printf("図形を認識しました: %s (一致度=%.2f)", name, score)
+
+	action, ok := b.stroke.Actions[name]
+	if !ok {
+		return nil
+	}
+	return b.actions.Execute(action, GestureInfo{
+		Shape:    name,
+		Fingers:  b.fingers,
+		Distance: b.distance,
+		Duration: time.Since(b.start),
+	})
+}
+
+func (b *strokeBackend) Close() error {
+	b.recognizer = nil
+	return nil
+}
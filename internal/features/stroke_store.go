@@ -0,0 +1,164 @@
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StrokeTemplate は図形のテンプレートを表す
+// 同じ名前で複数回記録した点列は Samples にまとめて保存され、すべて照合に使われる
+//
+// ファイル形式（<設定ディレクトリ>/strokes/<name>.json）:
+//
+//	{"name": "L", "samples": [[[0, 0], [0, 120], [80, 120]]]}
+//
+// 点はトラックボールの移動量を積算した座標 [x, y] で、y は下向きが正。
+// 認識時に大きさと位置をそろえるため、座標の原点や単位は問わない。
+type StrokeTemplate struct {
+	Name    string          `json:"name"`
+	Samples [][]StrokePoint `json:"samples"`
+}
+
+// テンプレートや記録の名前に使える文字（ファイル名としてそのまま使う）
+var storeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// StrokeStore は図形のテンプレートをディレクトリに保存する
+// 次に描かれた図形をテンプレートとして記録する予約も管理する
+type StrokeStore struct {
+	dir string
+
+	mu        sync.Mutex
+	recording string // 次のストロークを記録するテンプレート名
+}
+
+// 指定したディレクトリにテンプレートを保存するストアを作成する
+func NewStrokeStore(dir string) *StrokeStore {
+	return &StrokeStore{dir: dir}
+}
+
+// List は保存されているテンプレートを名前順に返す
+func (s *StrokeStore) List() ([]StrokeTemplate, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []StrokeTemplate{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("テンプレートディレクトリの読み込みに失敗しました: %w", err)
+	}
+
+	templates := []StrokeTemplate{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok || !storeNamePattern.MatchString(name) {
+			continue
+		}
+		t, err := s.load(name)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Add は点列をテンプレートのサンプルとして追加する
+func (s *StrokeStore) Add(name string, points []StrokePoint) error {
+	if !storeNamePattern.MatchString(name) {
+		return fmt.Errorf("テンプレート名は英数字、'-'、'_' の64文字以内で指定してください: %q", name)
+	}
+	if _, ok := normalizeStroke(points); !ok {
+		return fmt.Errorf("図形として記録するには2点以上の移動が必要です")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.load(name)
+	if errors.Is(err, os.ErrNotExist) {
+		t = StrokeTemplate{Name: name}
+	} else if err != nil {
+		return err
+	}
+	t.Samples = append(t.Samples, points)
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("テンプレートディレクトリの作成に失敗しました: %w", err)
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("テンプレートのエンコードに失敗しました: %w", err)
+	}
+	if err := os.WriteFile(s.path(name), data, 0644); err != nil {
+		return fmt.Errorf("テンプレートの保存に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// Delete はテンプレートを削除する
+func (s *StrokeStore) Delete(name string) error {
+	if !storeNamePattern.MatchString(name) {
+		return fmt.Errorf("テンプレート名が不正です: %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(name)); err != nil {
+		return fmt.Errorf("テンプレートの削除に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// Record は次に描かれた図形を name のテンプレートとして記録するよう予約する
+func (s *StrokeStore) Record(name string) error {
+	if !storeNamePattern.MatchString(name) {
+		return fmt.Errorf("テンプレート名は英数字、'-'、'_' の64文字以内で指定してください: %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recording = name
+	return nil
+}
+
+// Recording は記録を予約しているテンプレート名を返す
+func (s *StrokeStore) Recording() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recording
+}
+
+// takeRecording は記録の予約を取り出して解除する
+func (s *StrokeStore) takeRecording() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := s.recording
+	s.recording = ""
+	return name
+}
+
+func (s *StrokeStore) load(name string) (StrokeTemplate, error) {
+	data, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return StrokeTemplate{}, err
+	}
+	var t StrokeTemplate
+	if err := json.Unmarshal(data, &t); err != nil {
+		return StrokeTemplate{}, fmt.Errorf("テンプレート %s の解析に失敗しました: %w", name, err)
+	}
+	// ファイル名と中身の名前が食い違う場合はファイル名を優先する
+	t.Name = name
+	return t, nil
+}
+
+func (s *StrokeStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
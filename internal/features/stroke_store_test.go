@@ -0,0 +1,91 @@
+package features
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStrokeStoreRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "strokes")
+	store := NewStrokeStore(dir)
+
+	// ディレクトリがなくても空の一覧を返す
+	templates, err := store.List()
+	if err != nil || len(templates) != 0 {
+		t.Fatalf("空のストアの一覧が違います: %+v, %v", templates, err)
+	}
+
+	first := []StrokePoint{{0, 0}, {0, 120}, {80, 120}}
+	second := []StrokePoint{{0, 0}, {-3.5, 110}, {75, 118.25}}
+	for _, add := range []struct {
+		name   string
+		points []StrokePoint
+	}{{"L", first}, {"L", second}, {"swipe-right", strokeSample("right")}} {
+		if err := store.Add(add.name, add.points); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 別のストアから読み込んでも同じ内容になる
+	templates, err = NewStrokeStore(dir).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StrokeTemplate{
+		{Name: "L", Samples: [][]StrokePoint{first, second}},
+		{Name: "swipe-right", Samples: [][]StrokePoint{strokeSample("right")}},
+	}
+	if !reflect.DeepEqual(templates, want) {
+		t.Fatalf("読み込んだテンプレートが違います:\n got %+v\nwant %+v", templates, want)
+	}
+
+	if err := store.Delete("L"); err != nil {
+		t.Fatal(err)
+	}
+	templates, err = store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].Name != "swipe-right" {
+		t.Fatalf("削除後の一覧が違います: %+v", templates)
+	}
+}
+
+func TestStrokeStoreFileFormat(t *testing.T) {
+	dir := t.TempDir()
+	// 手で書いたファイルも読み込め、名前はファイル名を優先する
+	content := `{"name": "other", "samples": [[[0, 0], [0, 120], [80, 120]]]}`
+	if err := os.WriteFile(filepath.Join(dir, "L.json"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// テンプレート名として使えないファイルは無視する
+	if err := os.WriteFile(filepath.Join(dir, "not a name.json"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := NewStrokeStore(dir).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StrokeTemplate{{Name: "L", Samples: [][]StrokePoint{{{0, 0}, {0, 120}, {80, 120}}}}}
+	if !reflect.DeepEqual(templates, want) {
+		t.Fatalf("読み込んだテンプレートが違います:\n got %+v\nwant %+v", templates, want)
+	}
+}
+
+func TestStrokeStoreRejectsInvalidInput(t *testing.T) {
+	store := NewStrokeStore(t.TempDir())
+	for _, name := range []string{"", "../escape", "a b"} {
+		if err := store.Add(name, strokeSample("L")); err == nil {
+			t.Errorf("不正な名前 %q で保存できました", name)
+		}
+		if err := store.Record(name); err == nil {
+			t.Errorf("不正な名前 %q で記録を予約できました", name)
+		}
+	}
+	if err := store.Add("dot", []StrokePoint{{5, 5}}); err == nil {
+		t.Error("1点だけの図形を保存できました")
+	}
+}
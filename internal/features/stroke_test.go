@@ -0,0 +1,188 @@
+package features
+
+import (
+	"math"
+	"testing"
+)
+
+// 照合に使うテンプレート。y は下向きが正
+var strokeTemplates = []StrokeTemplate{
+	{Name: "L", Samples: [][]StrokePoint{{{0, 0}, {0, 100}, {60, 100}}}},
+	{Name: "V", Samples: [][]StrokePoint{{{0, 0}, {50, 100}, {100, 0}}}},
+	{Name: "Z", Samples: [][]StrokePoint{{{0, 0}, {100, 0}, {0, 100}, {100, 100}}}},
+	{Name: "right", Samples: [][]StrokePoint{{{0, 0}, {100, 0}}}},
+	{Name: "down", Samples: [][]StrokePoint{{{0, 0}, {0, 100}}}},
+}
+
+// transformStroke は点列を原点まわりに拡大・回転し、平行移動する
+func transformStroke(points []StrokePoint, sx, sy, degrees, dx, dy float64) []StrokePoint {
+	angle := degrees * math.Pi / 180
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	out := make([]StrokePoint, len(points))
+	for i, p := range points {
+		x, y := p[0]*sx, p[1]*sy
+		out[i] = StrokePoint{x*cos - y*sin + dx, x*sin + y*cos + dy}
+	}
+	return out
+}
+
+func strokeSample(name string) []StrokePoint {
+	for _, t := range strokeTemplates {
+		if t.Name == name {
+			return t.Samples[0]
+		}
+	}
+	panic("テンプレートがありません: " + name)
+}
+
+func TestStrokeRecognizer(t *testing.T) {
+	r := NewStrokeRecognizer(strokeTemplates)
+
+	cases := []struct {
+		name     string
+		points   []StrokePoint
+		want     string
+		minScore float64
+	}{
+		{"L そのまま", strokeSample("L"), "L", 0.99},
+		{"V そのまま", strokeSample("V"), "V", 0.99},
+		{"Z そのまま", strokeSample("Z"), "Z", 0.99},
+		{"L を3倍にして移動", transformStroke(strokeSample("L"), 3, 3, 0, 500, -200), "L", 0.99},
+		{"L を10度回転", transformStroke(strokeSample("L"), 1, 1, 10, 0, 0), "L", 0.85},
+		{"V を縮小して-12度回転", transformStroke(strokeSample("V"), 0.5, 0.5, -12, 0, 0), "V", 0.85},
+		{"Z を横に引き伸ばす", transformStroke(strokeSample("Z"), 2.5, 1, 0, 0, 0), "Z", 0.9},
+		{"右への直線を8度回転", transformStroke(strokeSample("right"), 1.5, 1.5, 8, 0, 0), "right", 0.9},
+		// 向きは正規化しないため、90度回転した直線は別の図形になる
+		{"右への直線を90度回転", transformStroke(strokeSample("right"), 1, 1, 90, 0, 0), "down", 0.99},
+		{"下への直線を-90度回転", transformStroke(strokeSample("down"), 1, 1, -90, 0, 0), "right", 0.99},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, score := r.Recognize(tc.points)
+			if name != tc.want {
+				t.Fatalf("認識した図形が違います: got %q (一致度 %.3f), want %q", name, score, tc.want)
+			}
+			if score < tc.minScore || score > 1 {
+				t.Fatalf("一致度が範囲外です: got %.3f, want %.2f 以上", score, tc.minScore)
+			}
+		})
+	}
+}
+
+func TestStrokeRecognizerRejectsDifferentShape(t *testing.T) {
+	// 逆向きに描いた L は最も近い候補でも一致度が下がる
+	r := NewStrokeRecognizer(strokeTemplates[:1])
+	_, exact := r.Recognize(strokeSample("L"))
+	_, reversed := r.Recognize([]StrokePoint{{60, 100}, {0, 100}, {0, 0}})
+	if reversed >= exact-0.2 {
+		t.Fatalf("逆向きの図形の一致度が高すぎます: %.3f (元の図形 %.3f)", reversed, exact)
+	}
+}
+
+func TestStrokeRecognizerNeedsPoints(t *testing.T) {
+	r := NewStrokeRecognizer(strokeTemplates)
+	for _, points := range [][]StrokePoint{nil, {{1, 1}}, {{1, 1}, {1, 1}}} {
+		if name, score := r.Recognize(points); name != "" || score != 0 {
+			t.Fatalf("点が足りないのに認識しました: %v -> %q %.3f", points, name, score)
+		}
+	}
+	if name, _ := NewStrokeRecognizer(nil).Recognize(strokeSample("L")); name != "" {
+		t.Fatalf("テンプレートがないのに認識しました: %q", name)
+	}
+}
+
+func TestResampleStroke(t *testing.T) {
+	// 長さの異なる区間でも経路に沿って等間隔に並ぶ
+	points := resampleStroke([]StrokePoint{{0, 0}, {10, 0}, {10, 90}}, strokeSamplePoints)
+	if len(points) != strokeSamplePoints {
+		t.Fatalf("点の数が違います: got %d, want %d", len(points), strokeSamplePoints)
+	}
+	interval := 100.0 / float64(strokeSamplePoints-1)
+	for i := 1; i < len(points); i++ {
+		// 角をまたぐ区間は直線距離が経路に沿った長さより短くなる
+		if d := pointDistance(points[i-1], points[i]); d > interval+1e-6 || d < interval*0.7 {
+			t.Fatalf("点 %d の間隔が違います: got %.3f, want %.3f", i, d, interval)
+		}
+	}
+	if last := points[len(points)-1]; pointDistance(last, StrokePoint{10, 90}) > 1e-6 {
+		t.Fatalf("終点が違います: %v", last)
+	}
+}
+
+// recordingExecutor は実行を求められた動作を記録する
+type recordingExecutor struct {
+	executed []GestureInfo
+}
+
+func (e *recordingExecutor) Execute(_ Action, info GestureInfo) error {
+	e.executed = append(e.executed, info)
+	return nil
+}
+
+func (e *recordingExecutor) Close() error { return nil }
+
+// drawStroke は点列を移動量に分けてバックエンドに渡す
+func drawStroke(t *testing.T, b GestureBackend, g Gesture, points []StrokePoint) {
+	t.Helper()
+	if err := b.Begin(g); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(points); i++ {
+		m := Motion{DX: int32(points[i][0] - points[i-1][0]), DY: int32(points[i][1] - points[i-1][1])}
+		if err := b.Move(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.End(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStrokeBackend(t *testing.T) {
+	store := NewStrokeStore(t.TempDir())
+	if err := store.Add("L", strokeSample("L")); err != nil {
+		t.Fatal(err)
+	}
+	executor := &recordingExecutor{}
+	backend := NewStrokeBackend(executor, store)
+	gesture := func(threshold float64) Gesture {
+		return Gesture{Fingers: 1, Stroke: StrokeOptions{
+			Threshold:   threshold,
+			MinDistance: 50,
+			Actions:     map[string]Action{"L": {Kind: ActionIPC, IPC: "workspace next"}},
+		}}
+	}
+	drawnL := transformStroke(strokeSample("L"), 2, 2, 5, 0, 0)
+
+	drawStroke(t, backend, gesture(0.8), drawnL)
+	if len(executor.executed) != 1 || executor.executed[0].Shape != "L" {
+		t.Fatalf("L の動作が実行されていません: %+v", executor.executed)
+	}
+
+	// 一致度が閾値に届かない場合は実行しない
+	drawStroke(t, backend, gesture(0.999), drawnL)
+	// わずかな移動は図形として扱わない
+	drawStroke(t, backend, gesture(0.8), transformStroke(strokeSample("L"), 0.2, 0.2, 0, 0, 0))
+	if len(executor.executed) != 1 {
+		t.Fatalf("実行しないはずの動作が実行されました: %+v", executor.executed[1:])
+	}
+
+	// 記録を予約した場合は認識せずにテンプレートとして保存する
+	if err := store.Record("Z"); err != nil {
+		t.Fatal(err)
+	}
+	drawStroke(t, backend, gesture(0.8), transformStroke(strokeSample("Z"), 2, 2, 0, 0, 0))
+	if store.Recording() != "" {
+		t.Fatal("記録の予約が解除されていません")
+	}
+	templates, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 2 || templates[1].Name != "Z" {
+		t.Fatalf("描いた図形が保存されていません: %+v", templates)
+	}
+	if len(executor.executed) != 1 {
+		t.Fatalf("記録中に動作が実行されました: %+v", executor.executed[1:])
+	}
+}
@@ -0,0 +1,83 @@
+package features
+
+import (
+	"math"
+	"time"
+)
+
+// SwipeDirection はスワイプの方向を表す
+type SwipeDirection string
+
+const (
+	SwipeLeft  SwipeDirection = "left"
+	SwipeRight SwipeDirection = "right"
+	SwipeUp    SwipeDirection = "up"
+	SwipeDown  SwipeDirection = "down"
+)
+
+// Swipe は認識したスワイプを表す
+type Swipe struct {
+	Direction SwipeDirection
+	Distance  float64       // 方向が確定するまでの移動量
+	Duration  time.Duration // 方向が確定するまでにかかった時間
+}
+
+// SwipeRecognizer はトラックボールの移動から上下左右のスワイプを認識する
+type SwipeRecognizer struct {
+	deadZone *DeadZone // 方向を確定する移動量を半径とする不感帯
+	velocity float64   // 方向を確定する最低速度（移動量/秒）。0の場合は速度を見ない
+	start    time.Time
+}
+
+// 新しいスワイプ認識器を作成する
+func NewSwipeRecognizer(distance float64, velocity float64) *SwipeRecognizer {
+	return &SwipeRecognizer{
+		deadZone: NewDeadZone(distance),
+		velocity: velocity,
+	}
+}
+
+// 蓄積した移動量を破棄して認識をやり直す
+func (r *SwipeRecognizer) Reset(now time.Time) {
+	r.deadZone.Reset()
+	r.start = now
+}
+
+// 移動量を追加し、スワイプが確定した場合はその内容を返す
+// 方向が確定するたびに蓄積した移動量はリセットされる
+func (r *SwipeRecognizer) Feed(dx int32, dy int32, now time.Time) (Swipe, bool) {
+	if r.start.IsZero() {
+		r.start = now
+	}
+	if !r.deadZone.Feed(dx, dy) {
+		return Swipe{}, false
+	}
+	dist := r.deadZone.Distance()
+
+	// 速度が足りない場合はゆっくりした移動とみなして最初からやり直す
+	if r.velocity > 0 {
+		elapsed := now.Sub(r.start).Seconds()
+		if elapsed > 0 && dist/elapsed < r.velocity {
+			r.Reset(now)
+			return Swipe{}, false
+		}
+	}
+
+	accX, accY := r.deadZone.Offset()
+	var dir SwipeDirection
+	if math.Abs(accX) >= math.Abs(accY) {
+		dir = SwipeRight
+		if accX < 0 {
+			dir = SwipeLeft
+		}
+	} else {
+		dir = SwipeDown
+		if accY < 0 {
+			dir = SwipeUp
+		}
+	}
+
+	swipe := Swipe{Direction: dir, Distance: dist, Duration: now.Sub(r.start)}
+	r.Reset(now)
+	return swipe, true
+}
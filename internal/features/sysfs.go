@@ -0,0 +1,199 @@
+package features
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+)
+
+// DefaultSysfsRoot は入力デバイスを探す sysfs のマウント先
+const DefaultSysfsRoot = "/sys"
+
+// キーボードとみなすために必要なキー（文字キーの四隅とスペース）
+var keyboardKeys = []int{
+	consts.KeyCodes["Q"],
+	consts.KeyCodes["P"],
+	consts.KeyCodes["A"],
+	consts.KeyCodes["Z"],
+	consts.KeyCodes["SPACE"],
+}
+
+// ScanDevicesAt は root 以下の sysfs から入力デバイスを列挙し、通知する機能でキーボードとマウスに分類する
+//
+// root/class/input/event* ごとに、親の入力デバイス(inputN)の name、phys、uniq、id と capabilities を読む。
+//   - マウス: EV_REL の REL_X と REL_Y を通知する
+//   - キーボード: EV_KEY で文字キーとスペースを通知する
+//
+// 両方の機能を持つ複合デバイスは、同じパスのキーボードとマウスとして両方を返す。
+// このプロセスが作成した仮想デバイスは含めない。
+func ScanDevicesAt(root string) ([]Device, error) {
+	classDir := filepath.Join(root, "class", "input")
+	entries, err := os.ReadDir(classDir)
+	if err != nil {
+		return nil, fmt.Errorf("入力デバイスの一覧を読み込めませんでした: %w", err)
+	}
+
+	own := ownVirtualDevices()
+	var devices []Device
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "event") {
+			continue
+		}
+		found, err := readSysfsDevice(filepath.Join(classDir, entry.Name()), own)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, found...)
+	}
+
+	sort.SliceStable(devices, func(i, j int) bool {
+		return eventNumber(devices[i].Path) < eventNumber(devices[j].Path)
+	})
+	return devices, nil
+}
+
+// ownVirtualDevices はこのプロセスが作成した仮想デバイスの sysfs 名を返す
+func ownVirtualDevices() map[string]bool {
+	own := make(map[string]bool)
+	for _, info := range VirtualDevices() {
+		if info.Sysname != "" {
+			own[info.Sysname] = true
+		}
+	}
+	return own
+}
+
+// readSysfsDevice はイベントノードの sysfs ディレクトリから、分類したデバイスを返す
+// own に含まれる sysfs 名の入力デバイスは除外する
+func readSysfsDevice(eventDir string, own map[string]bool) ([]Device, error) {
+	// root/class/input/eventN/device は親の入力デバイス(inputN)を指す
+	inputDir, err := filepath.EvalSymlinks(filepath.Join(eventDir, "device"))
+	if err != nil {
+		return nil, err
+	}
+	if own[filepath.Base(inputDir)] || isOwnVirtualDevice(inputDir) {
+		return nil, nil
+	}
+
+	evBits, err := readCapabilities(inputDir, "ev")
+	if err != nil {
+		return nil, err
+	}
+	base := Device{
+		Name:    readSysfsString(inputDir, "name"),
+		Path:    filepath.Join("/dev/input", filepath.Base(eventDir)),
+		Phys:    readSysfsString(inputDir, "phys"),
+		Uniq:    readSysfsString(inputDir, "uniq"),
+		Vendor:  readSysfsHex(inputDir, "id/vendor"),
+		Product: readSysfsHex(inputDir, "id/product"),
+	}
+
+	var devices []Device
+	if hasBit(evBits, consts.Key) {
+		keyBits, _ := readCapabilities(inputDir, "key")
+		if hasAllBits(keyBits, keyboardKeys) {
+			keyboard := base
+			keyboard.Type = DeviceTypeKeyboard
+			devices = append(devices, keyboard)
+		}
+	}
+	if hasBit(evBits, consts.Rel) {
+		relBits, _ := readCapabilities(inputDir, "rel")
+		if hasAllBits(relBits, []int{consts.RelX, consts.RelY}) {
+			mouse := base
+			mouse.Type = DeviceTypeMouse
+			devices = append(devices, mouse)
+		}
+	}
+	return devices, nil
+}
+
+// isOwnVirtualDevice は別のインスタンスを含め、このアプリケーションが作成した仮想デバイスかを返す
+// 仮想デバイスは固定のベンダーIDを使う。設定で識別子を変えた仮想タッチパッドは、このプロセスで作成した識別子と照合する
+func isOwnVirtualDevice(inputDir string) bool {
+	if !strings.Contains(filepath.ToSlash(inputDir), "/devices/virtual/") {
+		return false
+	}
+	vendor := readSysfsHex(inputDir, "id/vendor")
+	if vendor == consts.VirtualDeviceVendor {
+		return true
+	}
+	return virtualDevices.hasID(vendor, readSysfsHex(inputDir, "id/product"))
+}
+
+// readCapabilities は capabilities/<name> のビットマップを読み込む
+// ビットマップは long 単位の16進数を上位から空白区切りで並べたもの
+func readCapabilities(inputDir string, name string) ([]uint64, error) {
+	data, err := os.ReadFile(filepath.Join(inputDir, "capabilities", name))
+	if err != nil {
+		return nil, err
+	}
+	return parseCapabilities(string(data))
+}
+
+// parseCapabilities は sysfs のビットマップの文字列を、下位の long から順に並べた値に変換する
+func parseCapabilities(s string) ([]uint64, error) {
+	fields := strings.Fields(s)
+	words := make([]uint64, len(fields))
+	for i, field := range fields {
+		v, err := strconv.ParseUint(field, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ビットマップを解析できませんでした: %q", s)
+		}
+		words[len(fields)-1-i] = v
+	}
+	return words, nil
+}
+
+// hasBit はビットマップで bit が立っているかを返す
+// 1語の幅はカーネルの long で、実行環境の uint と同じとみなす
+func hasBit(words []uint64, bit int) bool {
+	i := bit / bits.UintSize
+	if i >= len(words) {
+		return false
+	}
+	return words[i]&(1<<(bit%bits.UintSize)) != 0
+}
+
+// hasAllBits はビットマップですべての bit が立っているかを返す
+func hasAllBits(words []uint64, bitList []int) bool {
+	for _, bit := range bitList {
+		if !hasBit(words, bit) {
+			return false
+		}
+	}
+	return true
+}
+
+// readSysfsString は sysfs の属性を読み込み、末尾の改行を取り除いて返す。読めない場合は空文字列
+func readSysfsString(dir string, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysfsHex は16進数で書かれた sysfs の属性を読み込む。読めない場合は0
+func readSysfsHex(dir string, name string) uint16 {
+	v, err := strconv.ParseUint(readSysfsString(dir, name), 16, 16)
+	if err != nil {
+		return 0
+	}
+	return uint16(v)
+}
+
+// eventNumber はイベントノードのパスから番号を返す
+func eventNumber(path string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "event"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
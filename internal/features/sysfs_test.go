@@ -0,0 +1,188 @@
+package features
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// fakeInputDevice は偽の sysfs に置く入力デバイス
+type fakeInputDevice struct {
+	event   string // イベントノードの名前 (eventN)
+	devPath string // root/devices からの親の入力デバイス(inputN)のパス
+	name    string
+	phys    string
+	uniq    string
+	vendor  uint16
+	product uint16
+	ev      []int
+	key     []int
+	rel     []int
+}
+
+// capabilityBitmap はビットの一覧を sysfs の capabilities の形式（long 単位の16進数を上位から並べたもの）にする
+func capabilityBitmap(bitList ...int) string {
+	words := []uint64{0}
+	for _, bit := range bitList {
+		i := bit / bits.UintSize
+		for len(words) <= i {
+			words = append(words, 0)
+		}
+		words[i] |= 1 << (bit % bits.UintSize)
+	}
+	fields := make([]string, len(words))
+	for i, w := range words {
+		fields[len(words)-1-i] = fmt.Sprintf("%x", w)
+	}
+	return strings.Join(fields, " ")
+}
+
+// addFakeInputDevice は root 以下に実際の sysfs と同じ配置で入力デバイスを作成する
+//
+//	root/devices/<devPath>/eventN/device -> ..
+//	root/class/input/eventN -> ../../devices/<devPath>/eventN
+func addFakeInputDevice(t *testing.T, root string, d fakeInputDevice) {
+	t.Helper()
+	inputDir := filepath.Join(root, "devices", d.devPath)
+	eventDir := filepath.Join(inputDir, d.event)
+	for _, dir := range []string{eventDir, filepath.Join(inputDir, "id"), filepath.Join(inputDir, "capabilities"), filepath.Join(root, "class", "input")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"name":              d.name + "\n",
+		"phys":              d.phys + "\n",
+		"uniq":              d.uniq + "\n",
+		"id/vendor":         fmt.Sprintf("%04x\n", d.vendor),
+		"id/product":        fmt.Sprintf("%04x\n", d.product),
+		"capabilities/ev":   capabilityBitmap(d.ev...) + "\n",
+		"capabilities/key":  capabilityBitmap(d.key...) + "\n",
+		"capabilities/rel":  capabilityBitmap(d.rel...) + "\n",
+		d.event + "/uevent": "DEVNAME=input/" + d.event + "\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(inputDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("..", filepath.Join(eventDir, "device")); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join("..", "..", "devices", d.devPath, d.event)
+	if err := os.Symlink(target, filepath.Join(root, "class", "input", d.event)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var (
+	fakeMouseButtons = []int{consts.MouseBtnLeft, consts.MouseBtnRight}
+
+	// USB で接続したキーボードとトラックボールの複合デバイス
+	fakeComposite = fakeInputDevice{
+		event:   "event3",
+		devPath: "pci0000:00/0000:00:14.0/usb1/1-2/1-2:1.0/0003:4653:0001.0001/input/input5",
+		name:    "Keyball44",
+		phys:    "usb-0000:00:14.0-2/input0",
+		vendor:  0x4653,
+		product: 0x0001,
+		ev:      []int{consts.Syn, consts.Key, consts.Rel},
+		key:     append(slices.Clone(keyboardKeys), fakeMouseButtons...),
+		rel:     []int{consts.RelX, consts.RelY, consts.RelWheel},
+	}
+	// by-id のリンクを持たない Bluetooth のマウス
+	fakeBluetoothMouse = fakeInputDevice{
+		event:   "event7",
+		devPath: "virtual/misc/uhid/0005:046D:B023.0004/input/input12",
+		name:    "MX Ergo Mouse",
+		phys:    "aa:bb:cc:dd:ee:ff",
+		uniq:    "11:22:33:44:55:66",
+		vendor:  0x046d,
+		product: 0xb023,
+		ev:      []int{consts.Syn, consts.Key, consts.Rel},
+		key:     fakeMouseButtons,
+		rel:     []int{consts.RelX, consts.RelY},
+	}
+	// 別のインスタンスが uinput で作成した仮想マウス
+	fakeOwnPointer = fakeInputDevice{
+		event:   "event9",
+		devPath: "virtual/input/input20",
+		name:    "VirtualPassthroughMouse",
+		vendor:  consts.VirtualDeviceVendor,
+		product: 0x0818,
+		ev:      []int{consts.Syn, consts.Key, consts.Rel},
+		key:     fakeMouseButtons,
+		rel:     []int{consts.RelX, consts.RelY},
+	}
+)
+
+func TestScanDevicesAt(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []fakeInputDevice{fakeComposite, fakeBluetoothMouse, fakeOwnPointer} {
+		addFakeInputDevice(t, root, d)
+	}
+
+	devices, err := ScanDevicesAt(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Device{
+		{Name: "Keyball44", Path: "/dev/input/event3", Type: DeviceTypeKeyboard, Phys: fakeComposite.phys, Vendor: 0x4653, Product: 0x0001},
+		{Name: "Keyball44", Path: "/dev/input/event3", Type: DeviceTypeMouse, Phys: fakeComposite.phys, Vendor: 0x4653, Product: 0x0001},
+		{Name: "MX Ergo Mouse", Path: "/dev/input/event7", Type: DeviceTypeMouse, Phys: fakeBluetoothMouse.phys, Uniq: fakeBluetoothMouse.uniq, Vendor: 0x046d, Product: 0xb023},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("検出したデバイスの数が違います: got %d, want %d\n%+v", len(devices), len(want), devices)
+	}
+	for i := range want {
+		if devices[i] != want[i] {
+			t.Errorf("デバイス %d が違います:\n got %+v\nwant %+v", i, devices[i], want[i])
+		}
+	}
+}
+
+func TestScanDevicesAtSkipsConfiguredTouchPadIdentity(t *testing.T) {
+	// 設定で識別子を変えた仮想タッチパッドにマウスの機能があっても、監視対象に含めない
+	custom := types.InputID{Bustype: consts.BusUsb, Vendor: 0x1234, Product: 0x5678, Version: 1}
+	virtualDevices.addID(custom)
+
+	root := t.TempDir()
+	addFakeInputDevice(t, root, fakeInputDevice{
+		event:   "event11",
+		devPath: "virtual/input/input30",
+		name:    "CustomTouchPad",
+		vendor:  custom.Vendor,
+		product: custom.Product,
+		ev:      []int{consts.Syn, consts.Key, consts.Rel},
+		key:     fakeMouseButtons,
+		rel:     []int{consts.RelX, consts.RelY},
+	})
+	// 同じ識別子でも uinput 以外のデバイスは監視対象にする
+	addFakeInputDevice(t, root, fakeInputDevice{
+		event:   "event12",
+		devPath: "pci0000:00/0000:00:14.0/usb1/1-3/1-3:1.0/input/input31",
+		name:    "Real Mouse",
+		vendor:  custom.Vendor,
+		product: custom.Product,
+		ev:      []int{consts.Syn, consts.Key, consts.Rel},
+		key:     fakeMouseButtons,
+		rel:     []int{consts.RelX, consts.RelY},
+	})
+
+	devices, err := ScanDevicesAt(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Name != "Real Mouse" {
+		t.Fatalf("検出したデバイスが違います: %+v", devices)
+	}
+}
@@ -0,0 +1,89 @@
+package features
+
+import (
+	"io"
+	"os"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// 絶対座標でポインターを動かす仮想タブレットを表現するインターフェース
+type Tablet interface {
+	// ペンを近接させたまま指定した座標へ移動する
+	MoveTo(x int32, y int32) error
+	// ペンを遠ざける
+	Leave() error
+	io.Closer
+}
+
+type virtualTablet struct {
+	name       []byte
+	deviceFile *os.File
+	writer     *eventWriter
+	inRange    bool
+}
+
+// 新しい仮想タブレットデバイスを作成する
+// 画面一体型ではない外付けタブレットとして振る舞うため INPUT_PROP_DIRECT は設定しない
+func CreateTablet(path string, name []byte) (Tablet, error) {
+	fd, err := createUinputDevice(path, uinputProfile{
+		kind: VirtualDeviceTablet,
+		name: name,
+		id: types.InputID{
+			Bustype: consts.BusUsb,
+			Vendor:  consts.VirtualDeviceVendor,
+			Product: 0x081a,
+			Version: 1,
+		},
+		keys: []int{
+			consts.BtnToolPen, // ペンの近接
+			consts.BtnTouch,   // ペン先の接触
+			consts.BtnStylus,  // ペンのサイドボタン
+		},
+		abs: []uinputAxis{
+			{code: consts.AbsX, min: 0, max: consts.TabletAxisMax, resolution: consts.TabletResolution},
+			{code: consts.AbsY, min: 0, max: consts.TabletAxisMax, resolution: consts.TabletResolution},
+		},
+		props: []int{consts.PropPointer},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &virtualTablet{name: name, deviceFile: fd, writer: newEventWriter(fd)}, nil
+}
+
+func (vt *virtualTablet) Close() error {
+	_ = vt.Leave()
+	_ = releaseDevice(vt.deviceFile)
+	return vt.deviceFile.Close()
+}
+
+func (vt *virtualTablet) MoveTo(x int32, y int32) error {
+	events := make([]types.Event, 0, 4)
+	if !vt.inRange {
+		events = append(events, types.Event{Type: consts.Key, Code: consts.BtnToolPen, Value: 1})
+	}
+	events = append(events,
+		types.Event{Type: consts.Abs, Code: consts.AbsX, Value: clampAxis(x, 0, consts.TabletAxisMax)},
+		types.Event{Type: consts.Abs, Code: consts.AbsY, Value: clampAxis(y, 0, consts.TabletAxisMax)},
+		types.Event{Type: consts.Syn, Code: consts.SynReport, Value: 0},
+	)
+	if err := vt.writer.write(events); err != nil {
+		return err
+	}
+	vt.inRange = true
+	return nil
+}
+
+func (vt *virtualTablet) Leave() error {
+	if !vt.inRange {
+		return nil
+	}
+	vt.inRange = false
+	return vt.writer.write([]types.Event{
+		{Type: consts.Key, Code: consts.BtnToolPen, Value: 0},
+		{Type: consts.Syn, Code: consts.SynReport, Value: 0},
+	})
+}
@@ -0,0 +1,44 @@
+package features
+
+import (
+	"github.com/char5742/keyball-gestures/internal/consts"
+)
+
+// tabletBackend はトラックボールの移動量を仮想タブレット上の絶対座標に変換する
+// キーを押すとタブレットの中央からポインターを動かすため、弾くような操作で画面をまたいで大きく移動できる
+type tabletBackend struct {
+	tablet Tablet
+	gain   float64
+	x, y   float64
+}
+
+// 仮想タブレットを出力先とするバックエンドを作成する
+func NewTabletBackend(tablet Tablet) GestureBackend {
+	return &tabletBackend{tablet: tablet}
+}
+
+func (b *tabletBackend) Begin(g Gesture) error {
+	b.gain = g.TabletGain
+	b.x = consts.TabletAxisMax / 2
+	b.y = consts.TabletAxisMax / 2
+	return nil
+}
+
+func (b *tabletBackend) Move(m Motion) error {
+	// ペンを近接させた時点でポインターが中央へ移動するため、動き始めるまでは何もしない
+	if m.DX == 0 && m.DY == 0 {
+		return nil
+	}
+
+	b.x = min(max(b.x+float64(m.DX)*b.gain, 0), consts.TabletAxisMax)
+	b.y = min(max(b.y+float64(m.DY)*b.gain, 0), consts.TabletAxisMax)
+	return b.tablet.MoveTo(int32(b.x), int32(b.y))
+}
+
+func (b *tabletBackend) End() error {
+	return b.tablet.Leave()
+}
+
+func (b *tabletBackend) Close() error {
+	return b.tablet.Close()
+}
@@ -0,0 +1,259 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrPlaybackBusy は再生中に別の再生を始めようとしたときのエラー
+var ErrPlaybackBusy = errors.New("別の操作を再生中です")
+
+// TouchRecorder は TouchPad への操作を直列化し、記録中は操作をフレームとして保存する
+// ジェスチャーループと再生の両方から同じタッチパッドを使うため、すべての操作をこの型を通して行う
+type TouchRecorder struct {
+	touchPad TouchPad
+	bounds   TouchPadBounds
+
+	mu        sync.Mutex
+	recording bool
+	start     time.Time
+	frames    []TouchFrame
+}
+
+// タッチパッドと、その座標の範囲を指定して作成する
+func NewTouchRecorder(touchPad TouchPad, bounds TouchPadBounds) *TouchRecorder {
+	return &TouchRecorder{touchPad: touchPad, bounds: bounds}
+}
+
+// Bounds はタッチパッドの座標の範囲を返す
+func (r *TouchRecorder) Bounds() TouchPadBounds {
+	return r.bounds
+}
+
+// StartRecording は以降の操作の記録を始める
+func (r *TouchRecorder) StartRecording() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording = true
+	r.start = time.Now()
+	r.frames = nil
+}
+
+// StopRecording は記録を終了し、記録したフレームを返す
+func (r *TouchRecorder) StopRecording() []TouchFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recording = false
+	frames := r.frames
+	r.frames = nil
+	return frames
+}
+
+// record は記録中であればフレームを追加する。呼び出し側で mu をロックしておくこと
+func (r *TouchRecorder) record(f TouchFrame) {
+	if !r.recording {
+		return
+	}
+	f.Time = time.Since(r.start).Microseconds()
+	r.frames = append(r.frames, f)
+}
+
+func (r *TouchRecorder) MultiTouchDown(slot int, trackingID int, x int32, y int32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(TouchFrame{Op: TouchOpDown, Slot: slot, TrackingID: trackingID, X: x, Y: y})
+	return r.touchPad.MultiTouchDown(slot, trackingID, x, y)
+}
+
+func (r *TouchRecorder) MultiTouchMove(slot int, x int32, y int32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(TouchFrame{Op: TouchOpMove, Slot: slot, X: x, Y: y})
+	return r.touchPad.MultiTouchMove(slot, x, y)
+}
+
+func (r *TouchRecorder) MultiTouchUp(slot int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(TouchFrame{Op: TouchOpUp, Slot: slot})
+	return r.touchPad.MultiTouchUp(slot)
+}
+
+func (r *TouchRecorder) SetContact(touchMajor int32, pressure int32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(TouchFrame{Op: TouchOpContact, TouchMajor: touchMajor, Pressure: pressure})
+	return r.touchPad.SetContact(touchMajor, pressure)
+}
+
+func (r *TouchRecorder) SingleTouchMove(dx int32, dy int32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(TouchFrame{Op: TouchOpSingleMove, DX: dx, DY: dy})
+	return r.touchPad.SingleTouchMove(dx, dy)
+}
+
+func (r *TouchRecorder) SingleTouchUp() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.record(TouchFrame{Op: TouchOpSingleUp})
+	return r.touchPad.SingleTouchUp()
+}
+
+func (r *TouchRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.touchPad.Close()
+}
+
+// TouchPlayer は記録したタッチ操作を元のタイミングでタッチパッドに再生する
+// 同時に再生できるのは1つだけで、再生を中断した場合も置いたままの指はすべて離す
+type TouchPlayer struct {
+	touchPad TouchPad
+	bounds   TouchPadBounds
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// 再生先のタッチパッドと、その座標の範囲を指定して作成する
+func NewTouchPlayer(touchPad TouchPad, bounds TouchPadBounds) *TouchPlayer {
+	return &TouchPlayer{touchPad: touchPad, bounds: bounds}
+}
+
+// Play は記録の再生を非同期に開始する
+// 返されるチャネルには再生の結果が1回だけ送られ、その後閉じられる
+func (p *TouchPlayer) Play(rec TouchRecording) (<-chan error, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.done != nil {
+		select {
+		case <-p.done:
+		default:
+			return nil, ErrPlaybackBusy
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	result := make(chan error, 1)
+	p.cancel = cancel
+	p.done = done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		result <- p.play(ctx, rec)
+		close(result)
+	}()
+	return result, nil
+}
+
+// Playing は再生中かどうかを返す
+func (p *TouchPlayer) Playing() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done == nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stop は再生を中断し、指を離し終えるまで待つ
+func (p *TouchPlayer) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+func (p *TouchPlayer) play(ctx context.Context, rec TouchRecording) (err error) {
+	down := make(map[int]bool)
+	singleDown := false
+
+	// 途中で中断やエラーがあっても指を置いたままにしない
+	defer func() {
+		for slot := range down {
+			if upErr := p.touchPad.MultiTouchUp(slot); upErr != nil && err == nil {
+				err = upErr
+			}
+		}
+		if singleDown {
+			if upErr := p.touchPad.SingleTouchUp(); upErr != nil && err == nil {
+				err = upErr
+			}
+		}
+	}()
+
+	start := time.Now()
+	for _, f := range rec.Frames {
+		wait := time.Until(start.Add(time.Duration(f.Time) * time.Microsecond))
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		f = scaleFrame(f, rec.TouchPad, p.bounds)
+		switch f.Op {
+		case TouchOpContact:
+			err = p.touchPad.SetContact(f.TouchMajor, f.Pressure)
+		case TouchOpDown:
+			err = p.touchPad.MultiTouchDown(f.Slot, f.TrackingID, f.X, f.Y)
+			down[f.Slot] = true
+		case TouchOpMove:
+			err = p.touchPad.MultiTouchMove(f.Slot, f.X, f.Y)
+		case TouchOpUp:
+			err = p.touchPad.MultiTouchUp(f.Slot)
+			delete(down, f.Slot)
+		case TouchOpSingleMove:
+			err = p.touchPad.SingleTouchMove(f.DX, f.DY)
+			singleDown = true
+		case TouchOpSingleUp:
+			err = p.touchPad.SingleTouchUp()
+			singleDown = false
+		default:
+			err = fmt.Errorf("不明な操作です: %s", f.Op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scaleFrame は記録時のタッチパッドの範囲から再生先の範囲へ座標を変換する
+func scaleFrame(f TouchFrame, from TouchPadBounds, to TouchPadBounds) TouchFrame {
+	if from == to || from.MaxX <= from.MinX || from.MaxY <= from.MinY {
+		return f
+	}
+	sx := float64(to.MaxX-to.MinX) / float64(from.MaxX-from.MinX)
+	sy := float64(to.MaxY-to.MinY) / float64(from.MaxY-from.MinY)
+
+	f.X = to.MinX + int32(float64(f.X-from.MinX)*sx)
+	f.Y = to.MinY + int32(float64(f.Y-from.MinY)*sy)
+	f.DX = int32(float64(f.DX) * sx)
+	f.DY = int32(float64(f.DY) * sy)
+	return f
+}
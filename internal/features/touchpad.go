@@ -1,17 +1,12 @@
 package features
 
 import (
-	"bytes"
-	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"os"
-	"syscall"
 
 	"github.com/char5742/keyball-gestures/internal/consts"
 	"github.com/char5742/keyball-gestures/internal/types"
-	"github.com/char5742/keyball-gestures/internal/utils"
 )
 
 // 絶対座標入力デバイスを表現するインターフェース
@@ -19,171 +14,153 @@ type TouchPad interface {
 	MultiTouchDown(slot int, trackingID int, x int32, y int32) error
 	MultiTouchMove(slot int, x int32, y int32) error
 	MultiTouchUp(slot int) error
+	// タッチの接触サイズと圧力を設定する
+	SetContact(touchMajor int32, pressure int32) error
+	// 1本指で相対移動する。端に近づいたら指を置き直して中央に戻す
+	SingleTouchMove(dx int32, dy int32) error
+	// 1本指のタッチを終了する
+	SingleTouchUp() error
 	io.Closer
 }
 
+// TouchPadSpec は作成する仮想タッチパッドの座標の範囲と識別子
+type TouchPadSpec struct {
+	Bounds     TouchPadBounds
+	Resolution int32 // 1mmあたりの座標の値。libinput はこの値からタッチパッドの大きさを求める
+	Slots      int   // マルチタッチスロットの数 (1-consts.MaxTouchPadSlots)
+	Name       string
+	ID         types.InputID
+}
+
+// 1本指操作で指を置き直す端の余白（軸の範囲に対する割合）
+const singleTouchEdgeMargin = 0.1
+
 type virtualTouchPad struct {
 	name       []byte
 	deviceFile *os.File
+	writer     *eventWriter
+	minX, maxX int32
+	minY, maxY int32
+	touchMajor int32
+	pressure   int32
+	slots      int                           // マルチタッチスロットの数
+	down       [consts.MaxTouchPadSlots]bool // 指を置いているスロット
+
+	// 1本指操作の状態
+	singleDown       bool
+	singleX, singleY int32
+	singleTrackingID int
 }
 
 // 新しいタッチパッドデバイスを作成する
-func CreateTouchPad(path string, name []byte, minX int32, maxX int32, minY int32, maxY int32) (TouchPad, error) {
-	fd, err := createTouchPad(path, name, minX, maxX, minY, maxY)
+func CreateTouchPad(path string, spec TouchPadSpec) (TouchPad, error) {
+	if spec.Slots < 1 || spec.Slots > consts.MaxTouchPadSlots {
+		return nil, fmt.Errorf("スロットの数が範囲外です: %d (1-%d)", spec.Slots, consts.MaxTouchPadSlots)
+	}
+	fd, err := createTouchPad(path, spec)
 	if err != nil {
 		return nil, err
 	}
 
-	return &virtualTouchPad{name: name, deviceFile: fd}, nil
+	return &virtualTouchPad{
+		name:       []byte(spec.Name),
+		deviceFile: fd,
+		writer:     newEventWriter(fd),
+		minX:       spec.Bounds.MinX,
+		maxX:       spec.Bounds.MaxX,
+		minY:       spec.Bounds.MinY,
+		maxY:       spec.Bounds.MaxY,
+		slots:      spec.Slots,
+		touchMajor: consts.DefaultTouchMajor,
+		pressure:   consts.DefaultPressure,
+	}, nil
 }
 
+// 置いたままの指をすべて離してからデバイスを破棄する
 func (vt *virtualTouchPad) Close() error {
+	_ = vt.SingleTouchUp()
+	for slot, down := range vt.down {
+		if down {
+			_ = vt.MultiTouchUp(slot)
+		}
+	}
 	_ = releaseDevice(vt.deviceFile)
 	return vt.deviceFile.Close()
 }
 
-func createTouchPad(path string, name []byte, minX int32, maxX int32, minY int32, maxY int32) (*os.File, error) {
-	deviceFile, err := createDeviceFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("could not create absolute axis input device: %v", err)
-	}
-
-	// キー入力イベント(EV_KEY)を登録する
-	// これによりマウスボタンやタッチ入力などの検出が可能になる
-	err = registerDevice(deviceFile, uintptr(consts.Key))
-	if err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("キー入力イベント(EV_KEY)の登録に失敗しました: %v", err)
-	}
-
-	// キー入力の種類（マウスボタン、タッチ検出など）を登録する
-	for _, ev := range []int{
-		consts.MouseBtnLeft,  // マウス左ボタン
-		consts.MouseBtnRight, // マウス右ボタン
-		consts.BtnTouch,      // 画面タッチの検出
-		consts.BtnToolFinger, // 指の接触検出
-	} {
-		if err = utils.IOCtl(deviceFile, consts.SetKeyBit, uintptr(ev)); err != nil {
-			_ = deviceFile.Close()
-			return nil, fmt.Errorf("キー入力種別の登録に失敗しました %v: %v", ev, err)
-		}
-	}
-
-	// 絶対座標入力イベント(EV_ABS)を登録する
-	// これによりタッチパッドの位置情報を取得可能になる
-	err = registerDevice(deviceFile, uintptr(consts.Abs))
-	if err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("絶対座標入力イベント(EV_ABS)の登録に失敗しました: %v", err)
-	}
-
-	// タッチパッドのプロパティを設定する
-	if err := utils.IOCtl(deviceFile, consts.SetPropBit, uintptr(consts.PropPointer)); err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("ポインターデバイスプロパティの設定に失敗しました: %v", err)
-	}
-	if err := utils.IOCtl(deviceFile, consts.SetPropBit, uintptr(consts.PropButtonpad)); err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("ボタンパッドプロパティの設定に失敗しました: %v", err)
-	}
-
-	// X軸とY軸の座標を登録する
-	for _, ev := range []int{consts.AbsX, consts.AbsY} {
-		if err = utils.IOCtl(deviceFile, consts.SetAbsBit, uintptr(ev)); err != nil {
-			_ = deviceFile.Close()
-			return nil, fmt.Errorf("座標軸の登録に失敗しました %v: %v", ev, err)
-		}
-	}
-
-	// マルチタッチイベントを登録する
-	for _, ev := range []int{
-		consts.AbsMtSlot,       // スロット（指の識別子）
-		consts.AbsMtPositionX,  // X座標
-		consts.AbsMtPositionY,  // Y座標
-		consts.AbsMtTrackingId, // タッチの追跡ID
-		consts.AbsMtTouchMajor, // タッチ領域の主軸
-		consts.AbsMtPressure,   // タッチ圧力
-	} {
-		if err = utils.IOCtl(deviceFile, consts.SetAbsBit, uintptr(ev)); err != nil {
-			_ = deviceFile.Close()
-			return nil, fmt.Errorf("マルチタッチイベントの登録に失敗しました %v: %v", ev, err)
-		}
-	}
-
-	var absMin [consts.AbsSize]int32
-	var absMax [consts.AbsSize]int32
-
-	absMin[consts.AbsX] = minX
-	absMax[consts.AbsX] = maxX
-	absMin[consts.AbsY] = minY
-	absMax[consts.AbsY] = maxY
-
-	absMin[consts.AbsMtSlot] = 0
-	absMax[consts.AbsMtSlot] = 9
-
-	absMin[consts.AbsMtPositionX] = minX
-	absMax[consts.AbsMtPositionX] = maxX
-	absMin[consts.AbsMtPositionY] = minY
-	absMax[consts.AbsMtPositionY] = maxY
-
-	absMin[consts.AbsMtTouchMajor] = 0
-	absMax[consts.AbsMtTouchMajor] = 255
-
-	absMin[consts.AbsMtPressure] = 0
-	absMax[consts.AbsMtPressure] = 255
-
-	userDev := types.UserDev{
-		Name: toUinputName(name),
-		ID: types.InputID{
-			Bustype: consts.BusUsb,
-			Vendor:  0x4711,
-			Product: 0x0817,
-			Version: 1,
+// 座標軸には resolution（1mmあたりの値）を設定する。libinput がジェスチャーの移動量を判定する基準になる
+func createTouchPad(path string, spec TouchPadSpec) (*os.File, error) {
+	b, res := spec.Bounds, spec.Resolution
+	return createUinputDevice(path, uinputProfile{
+		kind: VirtualDeviceTouchPad,
+		name: []byte(spec.Name),
+		id:   spec.ID,
+		// マウスボタンやタッチ入力などの検出
+		keys: []int{
+			consts.MouseBtnLeft,  // マウス左ボタン
+			consts.MouseBtnRight, // マウス右ボタン
+			consts.BtnTouch,      // 画面タッチの検出
+			consts.BtnToolFinger, // 指の接触検出
 		},
-		Absmin: absMin,
-		Absmax: absMax,
-	}
-
-	fd, err := createUsbDevice(deviceFile, userDev)
-	if err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("USBデバイスの作成に失敗しました: %v", err)
-	}
-
-	return fd, nil
+		// タッチパッドの位置情報とマルチタッチ
+		abs: []uinputAxis{
+			{code: consts.AbsX, min: b.MinX, max: b.MaxX, resolution: res},
+			{code: consts.AbsY, min: b.MinY, max: b.MaxY, resolution: res},
+			{code: consts.AbsMtSlot, min: 0, max: int32(spec.Slots - 1)},             // スロット（指の識別子）
+			{code: consts.AbsMtPositionX, min: b.MinX, max: b.MaxX, resolution: res}, // X座標
+			{code: consts.AbsMtPositionY, min: b.MinY, max: b.MaxY, resolution: res}, // Y座標
+			{code: consts.AbsMtTrackingId},                                           // タッチの追跡ID
+			{code: consts.AbsMtTouchMajor, min: 0, max: consts.TouchMajorMax},        // タッチ領域の主軸
+			{code: consts.AbsMtPressure, min: 0, max: consts.PressureMax},            // タッチ圧力
+		},
+		props: []int{consts.PropPointer, consts.PropButtonpad},
+	})
 }
 
 // タッチイベントを開始する
 func (vt *virtualTouchPad) MultiTouchDown(slot int, trackingID int, x int32, y int32) error {
+	if err := vt.checkSlot(slot); err != nil {
+		return err
+	}
 	events := []types.Event{
 		{Type: consts.Abs, Code: consts.AbsMtSlot, Value: int32(slot)},
 		{Type: consts.Abs, Code: consts.AbsMtTrackingId, Value: int32(trackingID)},
 		{Type: consts.Abs, Code: consts.AbsMtPositionX, Value: x},
 		{Type: consts.Abs, Code: consts.AbsMtPositionY, Value: y},
-		{Type: consts.Abs, Code: consts.AbsMtTouchMajor, Value: 50},
-		{Type: consts.Abs, Code: consts.AbsMtPressure, Value: 30},
+		{Type: consts.Abs, Code: consts.AbsMtTouchMajor, Value: vt.touchMajor},
+		{Type: consts.Abs, Code: consts.AbsMtPressure, Value: vt.pressure},
 		{Type: consts.Key, Code: consts.BtnTouch, Value: 1},
 		{Type: consts.Syn, Code: consts.SynReport, Value: 0},
 	}
 
-	return writeEvents(vt.deviceFile, events)
+	if err := vt.writer.write(events); err != nil {
+		return err
+	}
+	vt.down[slot] = true
+	return nil
 }
 
 // タッチ位置を更新する
 func (vt *virtualTouchPad) MultiTouchMove(slot int, x int32, y int32) error {
+	if err := vt.checkSlot(slot); err != nil {
+		return err
+	}
 	events := []types.Event{
 		{Type: consts.Abs, Code: consts.AbsMtSlot, Value: int32(slot)},
 		{Type: consts.Abs, Code: consts.AbsMtPositionX, Value: x},
 		{Type: consts.Abs, Code: consts.AbsMtPositionY, Value: y},
-		{Type: consts.Abs, Code: consts.AbsMtTouchMajor, Value: 50},
+		{Type: consts.Abs, Code: consts.AbsMtTouchMajor, Value: vt.touchMajor},
 		{Type: consts.Syn, Code: consts.SynReport, Value: 0},
 	}
 
-	return writeEvents(vt.deviceFile, events)
+	return vt.writer.write(events)
 }
 
 // タッチイベントを終了する
 func (vt *virtualTouchPad) MultiTouchUp(slot int) error {
+	if err := vt.checkSlot(slot); err != nil {
+		return err
+	}
 	events := []types.Event{
 		{Type: consts.Abs, Code: consts.AbsMtSlot, Value: int32(slot)},
 		{Type: consts.Abs, Code: consts.AbsMtTrackingId, Value: -1},
@@ -192,77 +169,98 @@ func (vt *virtualTouchPad) MultiTouchUp(slot int) error {
 		{Type: consts.Syn, Code: consts.SynReport, Value: 0},
 	}
 
-	return writeEvents(vt.deviceFile, events)
+	if err := vt.writer.write(events); err != nil {
+		return err
+	}
+	vt.down[slot] = false
+	return nil
 }
 
-// デバイスファイルを作成する
-func createDeviceFile(path string) (fd *os.File, err error) {
-	deviceFile, err := os.OpenFile(path, syscall.O_WRONLY|syscall.O_NONBLOCK, 0660)
-	if err != nil {
-		return nil, errors.New("デバイスファイルを開くのに失敗しました")
+// タッチの接触サイズと圧力を設定する
+// 値はデバイス作成時に通知した軸の範囲内でなければならない
+func (vt *virtualTouchPad) SetContact(touchMajor int32, pressure int32) error {
+	if touchMajor < 0 || touchMajor > consts.TouchMajorMax {
+		return fmt.Errorf("タッチ領域の長径が範囲外です: %d (0-%d)", touchMajor, consts.TouchMajorMax)
 	}
-	return deviceFile, err
+	if pressure < 0 || pressure > consts.PressureMax {
+		return fmt.Errorf("タッチ圧力が範囲外です: %d (0-%d)", pressure, consts.PressureMax)
+	}
+	vt.touchMajor = touchMajor
+	vt.pressure = pressure
+	return nil
 }
 
-// デバイスを解放する
-func releaseDevice(deviceFile *os.File) error {
-	return utils.IOCtl(deviceFile, consts.DevDestroy, uintptr(0))
-}
+// 1本指で相対移動する
+// 指が端の余白に入ると一度離して中央に置き直すため、移動量はパッドの幅に制限されない
+func (vt *virtualTouchPad) SingleTouchMove(dx int32, dy int32) error {
+	centerX := vt.minX + (vt.maxX-vt.minX)/2
+	centerY := vt.minY + (vt.maxY-vt.minY)/2
 
-// デバイスを登録する
-func registerDevice(deviceFile *os.File, evType uintptr) error {
-	err := utils.IOCtl(deviceFile, consts.SetEvBit, evType)
-	if err != nil {
-		defer deviceFile.Close()
-		err = releaseDevice(deviceFile)
-		if err != nil {
-			return fmt.Errorf("デバイスを解放するのに失敗しました: %v", err)
+	if !vt.singleDown {
+		if err := vt.singleTouchDown(centerX, centerY); err != nil {
+			return err
 		}
-		return fmt.Errorf("無効なファイルハンドルがutils.IOCtlから返されました: %v", err)
 	}
-	return nil
-}
 
-// USBデバイスを作成する
-func createUsbDevice(deviceFile *os.File, dev types.UserDev) (fd *os.File, err error) {
-	buf := new(bytes.Buffer)
-	err = binary.Write(buf, binary.LittleEndian, dev)
-	if err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("ユーザーデバイスバッファの書き込みに失敗しました: %v", err)
+	x := vt.singleX + dx
+	y := vt.singleY + dy
+
+	marginX := int32(float64(vt.maxX-vt.minX) * singleTouchEdgeMargin)
+	marginY := int32(float64(vt.maxY-vt.minY) * singleTouchEdgeMargin)
+	if x < vt.minX+marginX || x > vt.maxX-marginX || y < vt.minY+marginY || y > vt.maxY-marginY {
+		// 端に到達したので指を離して中央から移動し直す
+		if err := vt.SingleTouchUp(); err != nil {
+			return err
+		}
+		if err := vt.singleTouchDown(centerX, centerY); err != nil {
+			return err
+		}
+		x = clampAxis(centerX+dx, vt.minX+marginX, vt.maxX-marginX)
+		y = clampAxis(centerY+dy, vt.minY+marginY, vt.maxY-marginY)
 	}
-	_, err = deviceFile.Write(buf.Bytes())
-	if err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("デバイス構造体をデバイスファイルに書き込むのに失敗しました: %v", err)
+
+	if x == vt.singleX && y == vt.singleY {
+		return nil
 	}
+	vt.singleX, vt.singleY = x, y
+	return vt.MultiTouchMove(0, x, y)
+}
 
-	err = utils.IOCtl(deviceFile, consts.DevCreate, uintptr(0))
-	if err != nil {
-		_ = deviceFile.Close()
-		return nil, fmt.Errorf("デバイスの作成に失敗しました: %v", err)
+// 1本指のタッチを終了する
+func (vt *virtualTouchPad) SingleTouchUp() error {
+	if !vt.singleDown {
+		return nil
 	}
+	vt.singleDown = false
+	return vt.MultiTouchUp(0)
+}
 
-	return deviceFile, err
+// 1本指のタッチを開始する。タッチごとに新しい追跡IDを割り当てる
+func (vt *virtualTouchPad) singleTouchDown(x int32, y int32) error {
+	vt.singleTrackingID = (vt.singleTrackingID + 1) % 0xffff
+	if err := vt.MultiTouchDown(0, vt.singleTrackingID, x, y); err != nil {
+		return err
+	}
+	vt.singleDown = true
+	vt.singleX, vt.singleY = x, y
+	return nil
 }
 
-// イベントを書き込む
-func writeEvents(deviceFile *os.File, events []types.Event) error {
-	for _, ev := range events {
-		buf := new(bytes.Buffer)
-		if err := binary.Write(buf, binary.LittleEndian, ev); err != nil {
-			return fmt.Errorf("イベントをバッファに書き込むのに失敗しました: %v", err)
-		}
-		if _, err := deviceFile.Write(buf.Bytes()); err != nil {
-			return fmt.Errorf("イベントの書き込みに失敗しました: %v", err)
-		}
+// スロットがデバイス作成時に通知した範囲内かを確認する
+func (vt *virtualTouchPad) checkSlot(slot int) error {
+	if slot < 0 || slot >= vt.slots {
+		return fmt.Errorf("スロットが範囲外です: %d (0-%d)", slot, vt.slots-1)
 	}
 	return nil
 }
 
-// 名前をuinput用の固定長配列に変換する
-func toUinputName(name []byte) (uinputName [consts.MaxNameSize]byte) {
-	var fixedSizeName [consts.MaxNameSize]byte
-	copy(fixedSizeName[:], name)
-	return fixedSizeName
+// 値を軸の範囲内に制限する
+func clampAxis(value, min, max int32) int32 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
 }
@@ -0,0 +1,167 @@
+package features
+
+import (
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+)
+
+// touchPadBackend は仮想タッチパッドの指の動きとしてジェスチャーを出力する
+type touchPadBackend struct {
+	touchPad        TouchPad
+	bounds          TouchPadBounds
+	gesture         Gesture
+	fingerCount     int
+	fingerPositions [consts.MaxFingers]struct{ x, y int32 }
+	lastMoveTime    time.Time
+	active          bool
+}
+
+// 仮想タッチパッドを出力先とするバックエンドを作成する
+// bounds はタッチパッドの作成時に通知した座標の範囲
+func NewTouchPadBackend(touchPad TouchPad, bounds TouchPadBounds) GestureBackend {
+	return &touchPadBackend{touchPad: touchPad, bounds: bounds}
+}
+
+func (b *touchPadBackend) Begin(g Gesture) error {
+	b.gesture = g
+	b.lastMoveTime = time.Now()
+	b.active = true
+
+	if err := b.touchPad.SetContact(g.Layout.TouchMajor, g.Layout.Pressure); err != nil {
+		return err
+	}
+
+	if g.Pointer {
+		return nil
+	}
+
+	b.fingerCount = min(g.Fingers, consts.MaxFingers)
+	b.initFingers()
+	return nil
+}
+
+func (b *touchPadBackend) Move(m Motion) error {
+	if !b.active {
+		return nil
+	}
+
+	if b.gesture.Pointer {
+		return b.touchPad.SingleTouchMove(m.DX, m.DY)
+	}
+
+	// 動かしていない間も一定間隔で呼ばれるため、移動量がなければ何もしない
+	// ここで最後の移動時刻を更新すると、指を置き直す判定が働かなくなる
+	if m.DX == 0 && m.DY == 0 && m.RawDX == 0 && m.RawDY == 0 {
+		return nil
+	}
+
+	// 最後の移動から閾値を超えていれば指を置き直す
+	// これにより、タッチパッドの範囲内で無限にスクロールが可能
+	// 前のストロークの動きを持ち越さないよう、移動量のフィルターもリセットする
+	if m.Time.Sub(b.lastMoveTime) > b.gesture.ResetThreshold {
+		b.liftAllFingers()
+		if b.gesture.MotionFilter != nil {
+			b.gesture.MotionFilter.Reset()
+		}
+		b.initFingers()
+	}
+	b.lastMoveTime = m.Time
+
+	tp := b.bounds
+	for i := 0; i < b.fingerCount; i++ {
+		b.fingerPositions[i].x = clampAxis(b.fingerPositions[i].x+m.DX, tp.MinX, tp.MaxX)
+		b.fingerPositions[i].y = clampAxis(b.fingerPositions[i].y+m.DY, tp.MinY, tp.MaxY)
+
+		if err := b.touchPad.MultiTouchMove(i, b.fingerPositions[i].x, b.fingerPositions[i].y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *touchPadBackend) End() error {
+	if !b.active {
+		return nil
+	}
+	b.active = false
+
+	if b.gesture.Pointer {
+		return b.touchPad.SingleTouchUp()
+	}
+	b.liftAllFingers()
+	b.fingerCount = 0
+	return nil
+}
+
+// タッチパッドはサービスが所有するため、指を離すだけにとどめる
+func (b *touchPadBackend) Close() error {
+	return b.End()
+}
+
+// initFingers は指の初期位置を設定する
+// 指はアンカー座標を中心にバインディングの並べ方で配置し、パッドからはみ出す場合は全体を内側へずらす
+func (b *touchPadBackend) initFingers() {
+	tp := b.bounds
+	count := b.fingerCount
+	layout := b.gesture.Layout
+	anchorX, anchorY := layout.AnchorX, layout.AnchorY
+	spacing := layout.Spacing
+
+	// アンカーからの相対位置を計算する
+	minDX, maxDX, minDY, maxDY := int32(0), int32(0), int32(0), int32(0)
+	for i := 0; i < count; i++ {
+		// -1.0 から 1.0 の範囲で指の並び順を表す
+		t := 0.0
+		if count > 1 {
+			t = float64(2*i-(count-1)) / float64(count-1)
+		}
+		along := int32(t * float64(spacing*int32(count-1)) / 2)
+
+		var dx, dy int32
+		switch layout.Arrangement {
+		case ArrangeRow:
+			dx = along
+		case ArrangeArc:
+			// 中央の指ほど上に置き、外側の指を下げる
+			dx = along
+			dy = int32(t * t * float64(spacing) / 2)
+		default:
+			dy = along
+		}
+		b.fingerPositions[i].x = dx
+		b.fingerPositions[i].y = dy
+
+		minDX, maxDX = min(minDX, dx), max(maxDX, dx)
+		minDY, maxDY = min(minDY, dy), max(maxDY, dy)
+	}
+
+	// 端をアンカーにした場合でも指の間隔を保ったまま範囲内に収める
+	shiftX := fitShift(anchorX+minDX, anchorX+maxDX, tp.MinX, tp.MaxX)
+	shiftY := fitShift(anchorY+minDY, anchorY+maxDY, tp.MinY, tp.MaxY)
+
+	for i := 0; i < count; i++ {
+		b.fingerPositions[i].x = clampAxis(anchorX+b.fingerPositions[i].x+shiftX, tp.MinX, tp.MaxX)
+		b.fingerPositions[i].y = clampAxis(anchorY+b.fingerPositions[i].y+shiftY, tp.MinY, tp.MaxY)
+
+		_ = b.touchPad.MultiTouchDown(i, i, b.fingerPositions[i].x, b.fingerPositions[i].y)
+	}
+}
+
+// liftAllFingers はすべての指を持ち上げる
+func (b *touchPadBackend) liftAllFingers() {
+	for i := 0; i < b.fingerCount; i++ {
+		_ = b.touchPad.MultiTouchUp(i)
+	}
+}
+
+// fitShift は範囲 [lo, hi] を [min, max] に収めるために必要なずらし量を返す
+func fitShift(lo, hi, min, max int32) int32 {
+	if lo < min {
+		return min - lo
+	}
+	if hi > max {
+		return max - hi
+	}
+	return 0
+}
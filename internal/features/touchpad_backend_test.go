@@ -0,0 +1,93 @@
+package features
+
+import (
+	"testing"
+	"time"
+)
+
+// touchCall は仮想タッチパッドへの操作を表す
+type touchCall struct {
+	op   string // down, move, up
+	slot int
+}
+
+// recordingTouchPad は指の操作を記録するタッチパッド
+type recordingTouchPad struct {
+	calls []touchCall
+}
+
+func (p *recordingTouchPad) MultiTouchDown(slot int, _ int, _ int32, _ int32) error {
+	p.calls = append(p.calls, touchCall{"down", slot})
+	return nil
+}
+
+func (p *recordingTouchPad) MultiTouchMove(slot int, _ int32, _ int32) error {
+	p.calls = append(p.calls, touchCall{"move", slot})
+	return nil
+}
+
+func (p *recordingTouchPad) MultiTouchUp(slot int) error {
+	p.calls = append(p.calls, touchCall{"up", slot})
+	return nil
+}
+
+func (p *recordingTouchPad) SetContact(int32, int32) error      { return nil }
+func (p *recordingTouchPad) SingleTouchMove(int32, int32) error { return nil }
+func (p *recordingTouchPad) SingleTouchUp() error               { return nil }
+func (p *recordingTouchPad) Close() error                       { return nil }
+
+// count は記録した操作のうち op の数を返す
+func (p *recordingTouchPad) count(op string) int {
+	n := 0
+	for _, c := range p.calls {
+		if c.op == op {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTouchPadBackendResetsFingersAfterIdleTicks(t *testing.T) {
+	pad := &recordingTouchPad{}
+	backend := NewTouchPadBackend(pad, TouchPadBounds{MinX: 0, MaxX: 1000, MinY: 0, MaxY: 1000})
+	const threshold = 100 * time.Millisecond
+	if err := backend.Begin(Gesture{Fingers: 2, ResetThreshold: threshold}); err != nil {
+		t.Fatal(err)
+	}
+	if pad.count("down") != 2 {
+		t.Fatalf("指が置かれていません: %v", pad.calls)
+	}
+
+	start := time.Now()
+	if err := backend.Move(Motion{DX: 5, DY: 5, RawDX: 5, RawDY: 5, Time: start}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 動かしていない間も読み取りのタイムアウトごとに呼ばれる
+	for elapsed := time.Duration(0); elapsed <= 2*threshold; elapsed += 5 * time.Millisecond {
+		if err := backend.Move(Motion{Time: start.Add(elapsed)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pad.count("up") != 0 {
+		t.Fatalf("動かしていないのに指を置き直しました: %v", pad.calls)
+	}
+
+	// 閾値を超えて止まっていたので、次に動かしたときに指を置き直す
+	pad.calls = nil
+	if err := backend.Move(Motion{DX: 5, RawDX: 5, Time: start.Add(2*threshold + 5*time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if pad.count("up") != 2 || pad.count("down") != 2 || pad.count("move") != 2 {
+		t.Fatalf("指が置き直されていません: %v", pad.calls)
+	}
+
+	// 続けて動かした場合は置き直さない
+	pad.calls = nil
+	if err := backend.Move(Motion{DX: 5, RawDX: 5, Time: start.Add(2*threshold + 10*time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if pad.count("up") != 0 || pad.count("move") != 2 {
+		t.Fatalf("続けて動かしたのに指を置き直しました: %v", pad.calls)
+	}
+}
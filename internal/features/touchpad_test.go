@@ -0,0 +1,110 @@
+package features
+
+import (
+	"os"
+	"testing"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// newFileTouchPad は一時ファイルに書き込むタッチパッドを作成する
+func newFileTouchPad(tb testing.TB) *virtualTouchPad {
+	tb.Helper()
+	f, err := os.CreateTemp(tb.TempDir(), "touchpad")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = f.Close() })
+	return &virtualTouchPad{
+		deviceFile: f,
+		writer:     newEventWriter(f),
+		minX:       0,
+		maxX:       1000,
+		minY:       0,
+		maxY:       1000,
+		slots:      consts.DefaultTouchPadSlots,
+		touchMajor: consts.DefaultTouchMajor,
+		pressure:   consts.DefaultPressure,
+	}
+}
+
+func TestMultiTouchMoveDoesNotAllocate(t *testing.T) {
+	tp := newFileTouchPad(t)
+	var x int32
+	allocs := testing.AllocsPerRun(1000, func() {
+		x = (x + 1) % 1000
+		if err := tp.MultiTouchMove(0, x, 500); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("MultiTouchMove がメモリを確保しました: %v allocs/op", allocs)
+	}
+}
+
+func BenchmarkMultiTouchMove(b *testing.B) {
+	tp := newFileTouchPad(b)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		if err := tp.MultiTouchMove(0, int32(i%1000), 500); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCloseReleasesSingleTouch(t *testing.T) {
+	tp := newFileTouchPad(t)
+	if err := tp.SingleTouchMove(10, 10); err != nil {
+		t.Fatal(err)
+	}
+	path := tp.deviceFile.Name()
+	if err := tp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if tp.singleDown {
+		t.Fatal("Close の後も1本指のタッチが残っています")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ups int
+	for off := 0; off+eventSize <= len(data); off += eventSize {
+		e := decodeEvent(data[off : off+eventSize])
+		if e == (types.Event{Type: consts.Abs, Code: consts.AbsMtTrackingId, Value: -1}) {
+			ups++
+		}
+	}
+	if ups != 1 {
+		t.Fatalf("指を離したイベントの数が違います: got %d, want 1", ups)
+	}
+}
+
+func TestMultiTouchRejectsSlotOutOfRange(t *testing.T) {
+	tp := newFileTouchPad(t)
+	tp.slots = 4
+	for _, slot := range []int{-1, 4} {
+		if err := tp.MultiTouchDown(slot, slot, 10, 10); err == nil {
+			t.Errorf("MultiTouchDown がスロット %d を受け付けました", slot)
+		}
+		if err := tp.MultiTouchMove(slot, 10, 10); err == nil {
+			t.Errorf("MultiTouchMove がスロット %d を受け付けました", slot)
+		}
+		if err := tp.MultiTouchUp(slot); err == nil {
+			t.Errorf("MultiTouchUp がスロット %d を受け付けました", slot)
+		}
+	}
+	// 範囲外のスロットはデバイスに書き込まない
+	info, err := tp.deviceFile.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Fatalf("範囲外のスロットのイベントが書き込まれました: %d バイト", info.Size())
+	}
+	if err := tp.MultiTouchMove(3, 10, 10); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,205 @@
+package features
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// uevent を受け取るマルチキャストグループ
+const (
+	// カーネルが送る uevent。udev がデバイスファイルの権限を設定する前に届くため、開くのに失敗することがある
+	ueventKernelGroup = 1
+	// udev が処理を終えてから再送する uevent。デバイスファイルの作成と権限の設定が済んでいる
+	ueventUdevGroup = 2
+)
+
+// udev が動作しているかの判定に使うファイル
+const udevControlPath = "/run/udev/control"
+
+// udev が再送する uevent のヘッダー (struct udev_monitor_netlink_header)
+//
+//	prefix(8) "libudev\0"、magic(4) 0xfeedcafe（ビッグエンディアン）、header_size(4)、
+//	properties_off(4)、properties_len(4)、以降はフィルター用の値
+//
+// magic 以外の値は送信元のバイト順で書かれる
+const (
+	libudevPrefix     = "libudev\x00"
+	libudevMagic      = 0xfeedcafe
+	libudevHeaderSize = 24 // properties_len までの長さ
+)
+
+// 1件の uevent を受け取るバッファのサイズ
+const ueventBufferSize = 16 * 1024
+
+// Uevent はカーネルが通知するデバイスの追加や削除を表す
+type Uevent struct {
+	Action    string // add、remove、change など
+	DevPath   string // sysfs 上のパス (/devices/...)
+	Subsystem string
+	DevName   string // /dev からの相対パス (input/event5)
+	Seqnum    uint64
+}
+
+// ueventSource は uevent を1件ずつ返す
+type ueventSource interface {
+	next() (Uevent, error)
+	Close() error
+}
+
+// netlinkUeventSource は NETLINK_KOBJECT_UEVENT のソケットからカーネルの uevent を受け取る
+type netlinkUeventSource struct {
+	file *os.File
+	buf  []byte
+}
+
+// openNetlinkUevents は uevent を受け取るソケットを開く
+// udev が動作している場合は、デバイスファイルの準備が済んでから udev が再送するイベントを受け取る
+// コンテナ内など netlink を使えない環境ではエラーを返す
+func openNetlinkUevents() (*netlinkUeventSource, error) {
+	group := uint32(ueventUdevGroup)
+	if _, err := os.Stat(udevControlPath); err != nil {
+		// udev がなければデバイスファイルはカーネルが作成するため、カーネルのイベントを使う
+		log.Printf("udev が動作していないため、カーネルの uevent を受け取ります: %v", err)
+		group = ueventKernelGroup
+	}
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("uevent のソケットを作成できませんでした: %w", err)
+	}
+	// このグループへの送信には特権が必要なため、受け取ったイベントは udev かカーネルのものとみなせる
+	addr := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: group}
+	if err := syscall.Bind(fd, addr); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("uevent のソケットを登録できませんでした: %w", err)
+	}
+	// ノンブロッキングのソケットはランタイムのポーラーで待つため、Close で読み込みを中断できる
+	return &netlinkUeventSource{
+		file: os.NewFile(uintptr(fd), "uevent"),
+		buf:  make([]byte, ueventBufferSize),
+	}, nil
+}
+
+func (s *netlinkUeventSource) next() (Uevent, error) {
+	for {
+		n, err := s.file.Read(s.buf)
+		if err != nil {
+			return Uevent{}, err
+		}
+		if event, ok := parseUevent(s.buf[:n]); ok {
+			return event, nil
+		}
+	}
+}
+
+func (s *netlinkUeventSource) Close() error {
+	return s.file.Close()
+}
+
+// parseUevent はカーネルまたは udev の uevent を解析する
+// カーネルのメッセージは "action@devpath" に続いて KEY=VALUE を NUL 区切りで並べたもの。
+// udev のメッセージはヘッダーの後に、同じ形式の KEY=VALUE を並べたもの
+func parseUevent(msg []byte) (Uevent, bool) {
+	if bytes.HasPrefix(msg, []byte(libudevPrefix)) {
+		return parseUdevEvent(msg)
+	}
+	fields := bytes.Split(msg, []byte{0})
+	if !bytes.Contains(fields[0], []byte("@")) {
+		return Uevent{}, false
+	}
+	return parseUeventFields(fields[1:])
+}
+
+// parseUdevEvent は udev が再送した uevent を解析する
+func parseUdevEvent(msg []byte) (Uevent, bool) {
+	if len(msg) < libudevHeaderSize || binary.BigEndian.Uint32(msg[8:12]) != libudevMagic {
+		return Uevent{}, false
+	}
+	off := uint64(binary.NativeEndian.Uint32(msg[16:20]))
+	n := uint64(binary.NativeEndian.Uint32(msg[20:24]))
+	if off < libudevHeaderSize || off+n > uint64(len(msg)) {
+		return Uevent{}, false
+	}
+	event, ok := parseUeventFields(bytes.Split(msg[off:off+n], []byte{0}))
+	// udev は DEVNAME を /dev からの絶対パスで送るため、カーネルと同じ相対パスにそろえる
+	event.DevName = strings.TrimPrefix(event.DevName, "/dev/")
+	return event, ok
+}
+
+// parseUeventFields は KEY=VALUE の並びからイベントを組み立てる
+func parseUeventFields(fields [][]byte) (Uevent, bool) {
+	var event Uevent
+	for _, field := range fields {
+		event.set(string(field))
+	}
+	return event, event.Action != ""
+}
+
+// set は KEY=VALUE の1項目を取り込む。関係のない項目は無視する
+func (e *Uevent) set(field string) {
+	key, value, ok := strings.Cut(field, "=")
+	if !ok {
+		return
+	}
+	switch key {
+	case "ACTION":
+		e.Action = value
+	case "DEVPATH":
+		e.DevPath = value
+	case "SUBSYSTEM":
+		e.Subsystem = value
+	case "DEVNAME":
+		e.DevName = value
+	case "SEQNUM":
+		e.Seqnum, _ = strconv.ParseUint(value, 10, 64)
+	}
+}
+
+// readerUeventSource はテキストで書いた uevent の列を読み込む。動作確認用
+//
+// 1件のイベントは KEY=VALUE の行を並べたもので、空行で区切る。
+// = を含まない行は無視するため、udevadm monitor --udev --property の出力をそのまま使える。
+type readerUeventSource struct {
+	r       io.Reader
+	scanner *bufio.Scanner
+}
+
+func newReaderUeventSource(r io.Reader) *readerUeventSource {
+	return &readerUeventSource{r: r, scanner: bufio.NewScanner(r)}
+}
+
+func (s *readerUeventSource) next() (Uevent, error) {
+	var event Uevent
+	for s.scanner.Scan() {
+		line := strings.TrimSpace(s.scanner.Text())
+		if line == "" {
+			if event.Action != "" {
+				return event, nil
+			}
+			continue
+		}
+		event.set(line)
+	}
+	if err := s.scanner.Err(); err != nil {
+		return Uevent{}, err
+	}
+	if event.Action != "" {
+		return event, nil
+	}
+	return Uevent{}, io.EOF
+}
+
+func (s *readerUeventSource) Close() error {
+	if closer, ok := s.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
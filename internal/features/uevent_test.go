@@ -0,0 +1,80 @@
+package features
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestParseKernelUevent(t *testing.T) {
+	msg := "add@/devices/virtual/input/input20/event9\x00" +
+		"ACTION=add\x00DEVPATH=/devices/virtual/input/input20/event9\x00SUBSYSTEM=input\x00DEVNAME=input/event9\x00SEQNUM=4021\x00"
+
+	event, ok := parseUevent([]byte(msg))
+	if !ok {
+		t.Fatal("カーネルの uevent を解析できませんでした")
+	}
+	want := Uevent{Action: "add", DevPath: "/devices/virtual/input/input20/event9", Subsystem: "input", DevName: "input/event9", Seqnum: 4021}
+	if event != want {
+		t.Fatalf("解析結果が違います:\n got %+v\nwant %+v", event, want)
+	}
+}
+
+// udevMessage は udev が再送する形式のメッセージを作成する
+func udevMessage(properties string) []byte {
+	const headerSize = 40 // フィルター用の値を含めたヘッダーの長さ
+	msg := make([]byte, headerSize, headerSize+len(properties))
+	copy(msg, libudevPrefix)
+	binary.BigEndian.PutUint32(msg[8:12], libudevMagic)
+	binary.NativeEndian.PutUint32(msg[12:16], headerSize)
+	binary.NativeEndian.PutUint32(msg[16:20], headerSize)
+	binary.NativeEndian.PutUint32(msg[20:24], uint32(len(properties)))
+	return append(msg, properties...)
+}
+
+func TestParseUdevEvent(t *testing.T) {
+	properties := strings.Join([]string{
+		"ACTION=remove",
+		"DEVPATH=/devices/virtual/misc/uhid/0005:046D:B023.0004/input/input12/event7",
+		"SUBSYSTEM=input",
+		"DEVNAME=/dev/input/event7",
+		"SEQNUM=5120",
+		"ID_INPUT_MOUSE=1",
+		"",
+	}, "\x00")
+
+	event, ok := parseUevent(udevMessage(properties))
+	if !ok {
+		t.Fatal("udev の uevent を解析できませんでした")
+	}
+	// udev は DEVNAME を /dev からの絶対パスで送るが、カーネルと同じ相対パスにそろえる
+	want := Uevent{
+		Action:    "remove",
+		DevPath:   "/devices/virtual/misc/uhid/0005:046D:B023.0004/input/input12/event7",
+		Subsystem: "input",
+		DevName:   "input/event7",
+		Seqnum:    5120,
+	}
+	if event != want {
+		t.Fatalf("解析結果が違います:\n got %+v\nwant %+v", event, want)
+	}
+}
+
+func TestParseUdevEventRejectsBrokenHeader(t *testing.T) {
+	valid := udevMessage("ACTION=add\x00SUBSYSTEM=input\x00")
+
+	badMagic := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(badMagic[8:12], 0)
+	outOfRange := append([]byte(nil), valid...)
+	binary.NativeEndian.PutUint32(outOfRange[20:24], uint32(len(valid)))
+
+	for name, msg := range map[string][]byte{
+		"magic が違う": badMagic,
+		"本文が範囲外":    outOfRange,
+		"ヘッダーが短い":   valid[:libudevHeaderSize-1],
+	} {
+		if _, ok := parseUevent(msg); ok {
+			t.Errorf("%s: 不正なメッセージを受け付けました", name)
+		}
+	}
+}
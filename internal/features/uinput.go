@@ -0,0 +1,268 @@
+package features
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+	"github.com/char5742/keyball-gestures/internal/types"
+	"github.com/char5742/keyball-gestures/internal/utils"
+)
+
+// uinputProfile は仮想デバイスが通知する機能の組み合わせを表す
+type uinputProfile struct {
+	kind  string // 仮想デバイスの種類 (VirtualDevice*)
+	name  []byte
+	id    types.InputID
+	keys  []int        // EV_KEY で通知するキーとボタン
+	rels  []int        // EV_REL で通知する相対座標軸
+	abs   []uinputAxis // EV_ABS で通知する絶対座標軸
+	leds  []int        // EV_LED で受け付けるLED
+	rep   bool         // カーネルのキーリピート(EV_REP)を有効にする
+	props []int        // 入力デバイスのプロパティ
+}
+
+// uinputAxis は絶対座標軸の範囲と精度を表す
+// 仮想デバイスの座標はノイズを含まないため、fuzz と flat は通常0にする
+// 0以外にするとカーネルが小さな変化を捨ててしまう
+type uinputAxis struct {
+	code       int
+	min, max   int32
+	fuzz, flat int32
+	resolution int32 // 1mmあたりの値。libinput はタッチパッドの大きさをこの値から求める
+}
+
+// プロファイルに従ってuinputデバイスを作成する
+func createUinputDevice(path string, profile uinputProfile) (*os.File, error) {
+	// 作成した直後の uevent による再スキャンで監視対象に含めないよう、作成前に識別子を記録する
+	virtualDevices.addID(profile.id)
+
+	deviceFile, err := createDeviceFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create uinput device: %v", err)
+	}
+
+	// キー入力イベント(EV_KEY)とキーの種類を登録する
+	if len(profile.keys) > 0 {
+		if err := registerDevice(deviceFile, uintptr(consts.Key)); err != nil {
+			_ = deviceFile.Close()
+			return nil, fmt.Errorf("キー入力イベント(EV_KEY)の登録に失敗しました: %v", err)
+		}
+		for _, ev := range profile.keys {
+			if err := utils.IOCtl(deviceFile, consts.SetKeyBit, uintptr(ev)); err != nil {
+				_ = deviceFile.Close()
+				return nil, fmt.Errorf("キー入力種別の登録に失敗しました %v: %v", ev, err)
+			}
+		}
+	}
+
+	// 相対座標入力イベント(EV_REL)と軸を登録する
+	if len(profile.rels) > 0 {
+		if err := registerDevice(deviceFile, uintptr(consts.Rel)); err != nil {
+			_ = deviceFile.Close()
+			return nil, fmt.Errorf("相対座標入力イベント(EV_REL)の登録に失敗しました: %v", err)
+		}
+		for _, ev := range profile.rels {
+			if err := utils.IOCtl(deviceFile, consts.SetRelBit, uintptr(ev)); err != nil {
+				_ = deviceFile.Close()
+				return nil, fmt.Errorf("相対座標軸の登録に失敗しました %v: %v", ev, err)
+			}
+		}
+	}
+
+	// 絶対座標入力イベント(EV_ABS)と軸を登録する
+	if len(profile.abs) > 0 {
+		if err := registerDevice(deviceFile, uintptr(consts.Abs)); err != nil {
+			_ = deviceFile.Close()
+			return nil, fmt.Errorf("絶対座標入力イベント(EV_ABS)の登録に失敗しました: %v", err)
+		}
+		for _, axis := range profile.abs {
+			if err := utils.IOCtl(deviceFile, consts.SetAbsBit, uintptr(axis.code)); err != nil {
+				_ = deviceFile.Close()
+				return nil, fmt.Errorf("座標軸の登録に失敗しました %v: %v", axis.code, err)
+			}
+		}
+	}
+
+	// LEDイベント(EV_LED)とLEDの種類を登録する
+	// 登録したLEDの状態変更はuinputのファイルから読み取れる
+	if len(profile.leds) > 0 {
+		if err := registerDevice(deviceFile, uintptr(consts.Led)); err != nil {
+			_ = deviceFile.Close()
+			return nil, fmt.Errorf("LEDイベント(EV_LED)の登録に失敗しました: %v", err)
+		}
+		for _, led := range profile.leds {
+			if err := utils.IOCtl(deviceFile, consts.SetLedBit, uintptr(led)); err != nil {
+				_ = deviceFile.Close()
+				return nil, fmt.Errorf("LEDの登録に失敗しました %v: %v", led, err)
+			}
+		}
+	}
+
+	// キーリピート(EV_REP)を登録する
+	if profile.rep {
+		if err := registerDevice(deviceFile, uintptr(consts.Rep)); err != nil {
+			_ = deviceFile.Close()
+			return nil, fmt.Errorf("キーリピート(EV_REP)の登録に失敗しました: %v", err)
+		}
+	}
+
+	// デバイスのプロパティを設定する
+	for _, prop := range profile.props {
+		if err := utils.IOCtl(deviceFile, consts.SetPropBit, uintptr(prop)); err != nil {
+			_ = deviceFile.Close()
+			return nil, fmt.Errorf("デバイスプロパティの設定に失敗しました %v: %v", prop, err)
+		}
+	}
+
+	// 古いカーネルでは軸の精度を設定できないため、従来の構造体の書き込みで作成する
+	if supportsDevSetup(deviceFile) {
+		err = setupDevice(deviceFile, profile)
+	} else {
+		log.Printf("uinputがUI_DEV_SETUPに対応していないため、軸の精度を設定せずにデバイスを作成します")
+		err = setupLegacyDevice(deviceFile, profile)
+	}
+	if err != nil {
+		_ = deviceFile.Close()
+		return nil, err
+	}
+
+	if err := utils.IOCtl(deviceFile, consts.DevCreate, uintptr(0)); err != nil {
+		_ = deviceFile.Close()
+		return nil, fmt.Errorf("デバイスの作成に失敗しました: %v", err)
+	}
+
+	sysname, node, err := uinputEventNode(deviceFile)
+	if err == nil {
+		log.Printf("仮想デバイス %s を作成しました: %s (%s)", profile.name, node, sysname)
+	} else {
+		log.Printf("仮想デバイス %s を作成しました（イベントノードは不明です: %v）", profile.name, err)
+	}
+	virtualDevices.register(deviceFile, VirtualDeviceInfo{
+		Type:      profile.kind,
+		Name:      string(profile.name),
+		Sysname:   sysname,
+		EventNode: node,
+	})
+	return deviceFile, nil
+}
+
+// uinputがUI_DEV_SETUPとUI_ABS_SETUPに対応しているかを返す
+func supportsDevSetup(deviceFile *os.File) bool {
+	var version uint32
+	if err := utils.IOCtl(deviceFile, consts.GetVersion, uintptr(unsafe.Pointer(&version))); err != nil {
+		return false
+	}
+	return version >= consts.SetupMinVersion
+}
+
+// UI_ABS_SETUPで各軸の範囲と精度を、UI_DEV_SETUPで名前と識別子を設定する
+func setupDevice(deviceFile *os.File, profile uinputProfile) error {
+	for _, axis := range profile.abs {
+		setup := types.UinputAbsSetup{
+			Code: uint16(axis.code),
+			AbsInfo: types.AbsInfo{
+				Minimum:    axis.min,
+				Maximum:    axis.max,
+				Fuzz:       axis.fuzz,
+				Flat:       axis.flat,
+				Resolution: axis.resolution,
+			},
+		}
+		if err := utils.IOCtl(deviceFile, consts.AbsSetup, uintptr(unsafe.Pointer(&setup))); err != nil {
+			return fmt.Errorf("座標軸の設定に失敗しました %v: %v", axis.code, err)
+		}
+	}
+
+	setup := types.UinputSetup{
+		ID:   profile.id,
+		Name: toUinputName(profile.name),
+	}
+	if err := utils.IOCtl(deviceFile, consts.DevSetup, uintptr(unsafe.Pointer(&setup))); err != nil {
+		return fmt.Errorf("デバイスの設定に失敗しました: %v", err)
+	}
+	return nil
+}
+
+// 従来のuinput_user_dev構造体を書き込んで名前、識別子、軸の範囲を設定する
+// この方法では軸の精度(resolution)は設定できない
+func setupLegacyDevice(deviceFile *os.File, profile uinputProfile) error {
+	dev := types.UserDev{
+		Name: toUinputName(profile.name),
+		ID:   profile.id,
+	}
+	for _, axis := range profile.abs {
+		dev.Absmin[axis.code] = axis.min
+		dev.Absmax[axis.code] = axis.max
+		dev.Absfuzz[axis.code] = axis.fuzz
+		dev.Absflat[axis.code] = axis.flat
+	}
+
+	buf := new(bytes.Buffer)
+	if err := binary.Write(buf, binary.NativeEndian, dev); err != nil {
+		return fmt.Errorf("ユーザーデバイスバッファの書き込みに失敗しました: %v", err)
+	}
+	if _, err := deviceFile.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("デバイス構造体をデバイスファイルに書き込むのに失敗しました: %v", err)
+	}
+	return nil
+}
+
+// uinputEventNode は作成したデバイスのsysfs上の名前(inputN)と、イベントノード(/dev/input/eventN)を返す
+func uinputEventNode(deviceFile *os.File) (sysname string, node string, err error) {
+	var buf [consts.SysnameSize]byte
+	if err := utils.IOCtl(deviceFile, consts.GetSysname(len(buf)), uintptr(unsafe.Pointer(&buf[0]))); err != nil {
+		return "", "", fmt.Errorf("sysfs上の名前の取得に失敗しました: %v", err)
+	}
+	sysname = string(bytes.TrimRight(buf[:], "\x00"))
+
+	matches, err := filepath.Glob(filepath.Join("/sys/devices/virtual/input", sysname, "event*"))
+	if err != nil || len(matches) == 0 {
+		return sysname, "", fmt.Errorf("%s のイベントノードが見つかりません", sysname)
+	}
+	return sysname, filepath.Join("/dev/input", filepath.Base(matches[0])), nil
+}
+
+// デバイスファイルを作成する
+func createDeviceFile(path string) (fd *os.File, err error) {
+	// LEDなどデバイスへ送られたイベントを読み取れるよう読み書き両用で開く
+	deviceFile, err := os.OpenFile(path, syscall.O_RDWR|syscall.O_NONBLOCK, 0660)
+	if err != nil {
+		return nil, errors.New("デバイスファイルを開くのに失敗しました")
+	}
+	return deviceFile, err
+}
+
+// デバイスを解放する
+func releaseDevice(deviceFile *os.File) error {
+	virtualDevices.unregister(deviceFile)
+	return utils.IOCtl(deviceFile, consts.DevDestroy, uintptr(0))
+}
+
+// デバイスを登録する
+func registerDevice(deviceFile *os.File, evType uintptr) error {
+	err := utils.IOCtl(deviceFile, consts.SetEvBit, evType)
+	if err != nil {
+		defer deviceFile.Close()
+		err = releaseDevice(deviceFile)
+		if err != nil {
+			return fmt.Errorf("デバイスを解放するのに失敗しました: %v", err)
+		}
+		return fmt.Errorf("無効なファイルハンドルがutils.IOCtlから返されました: %v", err)
+	}
+	return nil
+}
+
+// 名前をuinput用の固定長配列に変換する
+func toUinputName(name []byte) (uinputName [consts.MaxNameSize]byte) {
+	var fixedSizeName [consts.MaxNameSize]byte
+	copy(fixedSizeName[:], name)
+	return fixedSizeName
+}
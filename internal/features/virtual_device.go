@@ -0,0 +1,143 @@
+package features
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/char5742/keyball-gestures/internal/types"
+)
+
+// 仮想デバイスの種類
+const (
+	VirtualDeviceTouchPad            = "touchpad"             // 仮想タッチパッド
+	VirtualDevicePointer             = "pointer"              // 仮想マウス
+	VirtualDeviceTablet              = "tablet"               // 仮想タブレット
+	VirtualDeviceKeyboard            = "keyboard"             // キー入力を送信する仮想キーボード
+	VirtualDevicePassthroughKeyboard = "passthrough_keyboard" // グラブしたキーボードの送り直し先
+)
+
+// VirtualDeviceInfo はこのプロセスが作成した仮想デバイスの情報を表す
+type VirtualDeviceInfo struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	Sysname   string    `json:"sysname,omitempty"`    // sysfs 上の名前 (inputN)
+	EventNode string    `json:"event_node,omitempty"` // イベントノード (/dev/input/eventN)
+	CreatedAt time.Time `json:"created_at"`
+	Events    uint64    `json:"events"` // 送信したイベントの数
+	Frames    uint64    `json:"frames"` // イベントをまとめて書き込んだ回数
+	Errors    uint64    `json:"errors"` // 書き込みに失敗した回数
+}
+
+// virtualDevice は登録した仮想デバイスと、その送信数の集計を表す
+type virtualDevice struct {
+	info   VirtualDeviceInfo
+	events atomic.Uint64
+	frames atomic.Uint64
+	errors atomic.Uint64
+}
+
+// virtualDeviceRegistry はこのプロセスが作成した仮想デバイスをデバイスファイルごとに管理する
+type virtualDeviceRegistry struct {
+	mu      sync.Mutex
+	devices map[*os.File]*virtualDevice
+	nextID  int
+
+	// 作成した仮想デバイスのベンダーIDと製品ID。破棄した後も残し、同じ設定の別のインスタンスの仮想デバイスも除外する
+	ids map[[2]uint16]bool
+}
+
+// プロセス全体で共有する仮想デバイスの一覧
+var virtualDevices = &virtualDeviceRegistry{
+	devices: make(map[*os.File]*virtualDevice),
+	ids:     make(map[[2]uint16]bool),
+}
+
+// addID は作成する仮想デバイスの識別子を記録する
+func (r *virtualDeviceRegistry) addID(id types.InputID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids[[2]uint16{id.Vendor, id.Product}] = true
+}
+
+// hasID は識別子がこのプロセスで作成した仮想デバイスのものかを返す
+func (r *virtualDeviceRegistry) hasID(vendor, product uint16) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ids[[2]uint16{vendor, product}]
+}
+
+// register は作成した仮想デバイスを登録する
+func (r *virtualDeviceRegistry) register(file *os.File, info VirtualDeviceInfo) *virtualDevice {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	info.ID = r.nextID
+	info.CreatedAt = time.Now()
+	device := &virtualDevice{info: info}
+	r.devices[file] = device
+	return device
+}
+
+// unregister は破棄した仮想デバイスを一覧から削除する
+func (r *virtualDeviceRegistry) unregister(file *os.File) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.devices, file)
+}
+
+// lookup はデバイスファイルに対応する仮想デバイスを返す。登録されていない場合は nil を返す
+func (r *virtualDeviceRegistry) lookup(file *os.File) *virtualDevice {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.devices[file]
+}
+
+// VirtualDevices はこのプロセスが作成した仮想デバイスを作成順に返す
+func VirtualDevices() []VirtualDeviceInfo {
+	virtualDevices.mu.Lock()
+	defer virtualDevices.mu.Unlock()
+
+	infos := make([]VirtualDeviceInfo, 0, len(virtualDevices.devices))
+	for _, device := range virtualDevices.devices {
+		infos = append(infos, device.snapshot())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// LookupVirtualDevice は ID に対応する仮想デバイスの情報を返す
+func LookupVirtualDevice(id int) (VirtualDeviceInfo, bool) {
+	virtualDevices.mu.Lock()
+	defer virtualDevices.mu.Unlock()
+
+	for _, device := range virtualDevices.devices {
+		if device.info.ID == id {
+			return device.snapshot(), true
+		}
+	}
+	return VirtualDeviceInfo{}, false
+}
+
+// snapshot は集計値を含めた現在の情報を返す
+func (d *virtualDevice) snapshot() VirtualDeviceInfo {
+	info := d.info
+	info.Events = d.events.Load()
+	info.Frames = d.frames.Load()
+	info.Errors = d.errors.Load()
+	return info
+}
+
+// count は1回の書き込みの結果を集計する
+func (d *virtualDevice) count(events int, err error) {
+	if err != nil {
+		d.errors.Add(1)
+		return
+	}
+	d.frames.Add(1)
+	d.events.Add(uint64(events))
+}
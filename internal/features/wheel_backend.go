@@ -0,0 +1,63 @@
+package features
+
+import (
+	"github.com/char5742/keyball-gestures/internal/consts"
+)
+
+// wheelBackend はトラックボールの移動を仮想マウスのホイールイベントとして出力する
+type wheelBackend struct {
+	pointer Pointer
+	wheel   WheelOptions
+
+	// 高解像度の値に換算しきれなかった端数
+	remainderV float64
+	remainderH float64
+}
+
+// 仮想マウスのホイールを出力先とするバックエンドを作成する
+func NewWheelBackend(pointer Pointer) GestureBackend {
+	return &wheelBackend{pointer: pointer}
+}
+
+func (b *wheelBackend) Begin(g Gesture) error {
+	b.wheel = g.Wheel
+	b.remainderV = 0
+	b.remainderH = 0
+	// 前のジェスチャーの端数で、動かし始めにホイールが1ノッチ回らないようにする
+	b.pointer.ResetWheel()
+	return nil
+}
+
+func (b *wheelBackend) Move(m Motion) error {
+	if m.DX == 0 && m.DY == 0 {
+		return nil
+	}
+
+	// 1ノッチ分の移動量で高解像度の値が120になるように換算する
+	scale := float64(consts.WheelHiResPerDetent) / float64(b.wheel.DetentSize)
+	if b.wheel.Invert {
+		scale = -scale
+	}
+
+	// トラックボールを上に転がすとホイールを上に回したことにする
+	v := -float64(m.DY)*scale + b.remainderV
+	h := float64(m.DX)*scale + b.remainderH
+
+	vertical := int32(v)
+	horizontal := int32(h)
+	b.remainderV = v - float64(vertical)
+	b.remainderH = h - float64(horizontal)
+
+	return b.pointer.Wheel(vertical, horizontal)
+}
+
+func (b *wheelBackend) End() error {
+	b.remainderV = 0
+	b.remainderH = 0
+	b.pointer.ResetWheel()
+	return nil
+}
+
+func (b *wheelBackend) Close() error {
+	return b.pointer.Close()
+}
@@ -20,3 +20,27 @@ type UserDev struct {
 	Absfuzz    [consts.AbsSize]int32    // 絶対座標のファジー値
 	Absflat    [consts.AbsSize]int32    // 絶対座標のフラット値
 }
+
+// AbsInfo は絶対座標軸の範囲と精度を表す構造体
+type AbsInfo struct {
+	Value      int32 // 現在値
+	Minimum    int32 // 最小値
+	Maximum    int32 // 最大値
+	Fuzz       int32 // ノイズとして無視する変化量
+	Flat       int32 // 中央とみなす範囲
+	Resolution int32 // 1mmあたりの値
+}
+
+// UinputSetup はUI_DEV_SETUPで設定するデバイスの名前と識別子を表す構造体
+type UinputSetup struct {
+	ID           InputID                  // デバイス識別子
+	Name         [consts.MaxNameSize]byte // デバイス名
+	FFEffectsMax uint32                   // 最大エフェクト数
+}
+
+// UinputAbsSetup はUI_ABS_SETUPで設定する絶対座標軸を表す構造体
+type UinputAbsSetup struct {
+	Code    uint16  // 軸のコード
+	_       uint16  // 境界合わせ
+	AbsInfo AbsInfo // 軸の範囲と精度
+}
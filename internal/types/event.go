@@ -1,11 +1,17 @@
 package types
 
-import "syscall"
-
 // Event は入力イベントを表す構造体
+// カーネルの struct input_event はアーキテクチャによって時刻の幅が異なるため、
+// バイト列との変換は features パッケージのイベントコーデックで行う
 type Event struct {
-	Time  syscall.Timeval // イベント発生時刻
-	Type  uint16          // イベントタイプ
-	Code  uint16          // イベントコード
-	Value int32           // イベント値
+	Time  EventTime // イベント発生時刻
+	Type  uint16    // イベントタイプ
+	Code  uint16    // イベントコード
+	Value int32     // イベント値
+}
+
+// EventTime はイベント発生時刻を表す構造体
+type EventTime struct {
+	Sec  int64 // 秒
+	Usec int64 // マイクロ秒
 }
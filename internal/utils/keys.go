@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/char5742/keyball-gestures/internal/consts"
+)
+
+// ParseKeyCombo は "SUPER+LEFT" のようなキーの組み合わせをキーコードの列に変換する
+// キー名は大文字小文字を区別せず、KEY_ 接頭辞は省略できる
+func ParseKeyCombo(combo string) ([]int, error) {
+	if strings.TrimSpace(combo) == "" {
+		return nil, fmt.Errorf("キーが指定されていません")
+	}
+
+	var codes []int
+	for _, part := range strings.Split(combo, "+") {
+		name := strings.ToUpper(strings.TrimSpace(part))
+		name = strings.TrimPrefix(name, "KEY_")
+		if alias, ok := consts.KeyAliases[name]; ok {
+			name = alias
+		}
+
+		code, ok := consts.KeyCodes[name]
+		if !ok {
+			return nil, fmt.Errorf("不明なキー名です: %q", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}